@@ -0,0 +1,59 @@
+package api
+
+import (
+	"time"
+)
+
+// SystemHistoryType represents the kind of event recorded in the system history.
+type SystemHistoryType string
+
+const (
+	// SystemHistoryTypeOSUpdate is used when an OS update is installed.
+	SystemHistoryTypeOSUpdate SystemHistoryType = "os-update"
+
+	// SystemHistoryTypeApplicationUpdate is used when an application is installed or updated.
+	SystemHistoryTypeApplicationUpdate SystemHistoryType = "application-update"
+
+	// SystemHistoryTypeRollback is used when a failed OS or application update is rolled back.
+	SystemHistoryTypeRollback SystemHistoryType = "rollback"
+
+	// SystemHistoryTypeReboot is used when the system is rebooted.
+	SystemHistoryTypeReboot SystemHistoryType = "reboot"
+
+	// SystemHistoryTypeShutdown is used when the system is shut down.
+	SystemHistoryTypeShutdown SystemHistoryType = "shutdown"
+
+	// SystemHistoryTypeProviderChange is used when a different provider is configured or serves a component.
+	SystemHistoryTypeProviderChange SystemHistoryType = "provider-change"
+
+	// SystemHistoryTypeUpdateCheck is used when an update check fails.
+	SystemHistoryTypeUpdateCheck SystemHistoryType = "update-check"
+)
+
+// SystemHistoryOutcome represents the result of a recorded event.
+type SystemHistoryOutcome string
+
+const (
+	// SystemHistoryOutcomeSuccess is used when the event completed.
+	SystemHistoryOutcomeSuccess SystemHistoryOutcome = "success"
+
+	// SystemHistoryOutcomeFailure is used when the event failed.
+	SystemHistoryOutcomeFailure SystemHistoryOutcome = "failure"
+)
+
+// SystemHistoryEntry represents a single event in the update and lifecycle history.
+type SystemHistoryEntry struct {
+	Timestamp time.Time            `json:"timestamp" yaml:"timestamp"`
+	Type      SystemHistoryType    `json:"type"      yaml:"type"`
+	Outcome   SystemHistoryOutcome `json:"outcome"   yaml:"outcome"`
+
+	// Component is the OS or application name the event applies to, if any.
+	Component string `json:"component,omitempty" yaml:"component,omitempty"`
+
+	// Versions before and after the event, if any.
+	FromVersion string `json:"from_version,omitempty" yaml:"from_version,omitempty"`
+	ToVersion   string `json:"to_version,omitempty"   yaml:"to_version,omitempty"`
+
+	Provider string `json:"provider,omitempty" yaml:"provider,omitempty"`
+	Message  string `json:"message,omitempty"  yaml:"message,omitempty"`
+}
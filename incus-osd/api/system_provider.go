@@ -1,15 +1,29 @@
 package api
 
+// SystemProviderFallback holds the configuration of a provider to fall back to.
+type SystemProviderFallback struct {
+	Name   string            `json:"name"   yaml:"name"`
+	Config map[string]string `json:"config" yaml:"config"`
+}
+
 // SystemProviderConfig holds the modifiable part of the provider data.
 type SystemProviderConfig struct {
 	Name   string            `json:"name"   yaml:"name"`
 	Config map[string]string `json:"config" yaml:"config"`
+
+	// Fallbacks are tried in order whenever the previous provider is unreachable.
+	Fallbacks []SystemProviderFallback `json:"fallbacks,omitempty" yaml:"fallbacks,omitempty"`
 }
 
 // SystemProvider defines a struct to hold information about the system's update and configuration provider.
 type SystemProvider struct {
 	Config SystemProviderConfig `json:"config" yaml:"config"`
 	State  struct {
-		Registered bool `json:"registered" yaml:"registered"`
+		Registered bool   `json:"registered" yaml:"registered"`
+		Channel    string `json:"channel"    yaml:"channel"`
+
+		// Which provider served the current OS update and each application.
+		OSProvider           string            `json:"os_provider"           yaml:"os_provider"`
+		ApplicationProviders map[string]string `json:"application_providers" yaml:"application_providers"`
 	} `json:"state"  yaml:"state"`
 }
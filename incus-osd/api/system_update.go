@@ -0,0 +1,217 @@
+package api
+
+import (
+	"time"
+)
+
+// SystemUpdatePolicy controls which release of a component gets installed.
+type SystemUpdatePolicy struct {
+	// Hold keeps the currently installed release, ignoring any update.
+	Hold bool `json:"hold" yaml:"hold"`
+
+	// Version pins a specific release, allowing for explicit downgrades. Empty follows the latest release.
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+// SystemUpdateMaintenanceWindow defines a recurring time range during which an action is allowed.
+type SystemUpdateMaintenanceWindow struct {
+	// Days the window starts on ("monday", "tuesday", ...). Empty means every day.
+	Days []string `json:"days,omitempty" yaml:"days,omitempty"`
+
+	// Start and end times (HH:MM). An end time before the start time wraps past midnight
+	// and identical start and end times cover the whole day.
+	Start string `json:"start" yaml:"start"`
+	End   string `json:"end"   yaml:"end"`
+}
+
+// SystemUpdateMaintenance holds the maintenance windows for each update action.
+// An action without any window is allowed at any time.
+type SystemUpdateMaintenance struct {
+	// Timezone the windows are expressed in (defaults to UTC).
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+
+	Download          []SystemUpdateMaintenanceWindow `json:"download,omitempty"           yaml:"download,omitempty"`
+	ApplyApplications []SystemUpdateMaintenanceWindow `json:"apply_applications,omitempty" yaml:"apply_applications,omitempty"`
+	Reboot            []SystemUpdateMaintenanceWindow `json:"reboot,omitempty"             yaml:"reboot,omitempty"`
+
+	// OverrideUntil ignores all windows until the provided time.
+	OverrideUntil *time.Time `json:"override_until,omitempty" yaml:"override_until,omitempty"`
+}
+
+// SystemUpdateBandwidthWindow overrides the download rate limit during a recurring time range.
+type SystemUpdateBandwidthWindow struct {
+	// Days the window starts on ("monday", "tuesday", ...). Empty means every day.
+	Days []string `json:"days,omitempty" yaml:"days,omitempty"`
+
+	// Start and end times (HH:MM), following the same rules as maintenance windows.
+	Start string `json:"start" yaml:"start"`
+	End   string `json:"end"   yaml:"end"`
+
+	// Limit applied during the window (for example "10Mbit"). Empty or "0" means unlimited.
+	Limit string `json:"limit" yaml:"limit"`
+}
+
+// SystemUpdateBandwidth limits the rate at which updates are downloaded.
+type SystemUpdateBandwidth struct {
+	// Timezone the windows are expressed in (defaults to UTC).
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+
+	// Limit applied outside of any window (for example "50Mbit"). Empty or "0" means unlimited.
+	Limit string `json:"limit,omitempty" yaml:"limit,omitempty"`
+
+	// Windows overriding the limit, the first matching one being used.
+	Windows []SystemUpdateBandwidthWindow `json:"windows,omitempty" yaml:"windows,omitempty"`
+}
+
+// SystemUpdateRetention controls how many images are kept on disk.
+type SystemUpdateRetention struct {
+	// Number of images kept for each application, including the installed and previous ones (defaults to 2).
+	Applications int `json:"applications,omitempty" yaml:"applications,omitempty"`
+
+	// Number of OS updates kept, allowing them to be re-applied without downloading them (defaults to 0).
+	OS int `json:"os,omitempty" yaml:"os,omitempty"`
+}
+
+// SystemUpdatePeerCache controls serving downloaded release files to other systems on the local network.
+type SystemUpdatePeerCache struct {
+	// Enabled serves the release files verified by this system to the "peer" provider of other systems.
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// IP address (and optional port, defaulting to 8444) of the local network interface the cache listens on.
+	Address string `json:"address,omitempty" yaml:"address,omitempty"`
+}
+
+// SystemUpdateRetainedImage describes an OS or application image kept on disk.
+type SystemUpdateRetainedImage struct {
+	Version string `json:"version" yaml:"version"`
+
+	// Size of the image in bytes.
+	Size int64 `json:"size" yaml:"size"`
+}
+
+// SystemUpdateConfig holds the modifiable part of the update data.
+type SystemUpdateConfig struct {
+	OS           SystemUpdatePolicy            `json:"os"                     yaml:"os"`
+	Applications map[string]SystemUpdatePolicy `json:"applications,omitempty" yaml:"applications,omitempty"`
+	Maintenance  SystemUpdateMaintenance       `json:"maintenance"            yaml:"maintenance"`
+	Retention    SystemUpdateRetention         `json:"retention"              yaml:"retention"`
+	PeerCache    SystemUpdatePeerCache         `json:"peer_cache"             yaml:"peer_cache"`
+	Bandwidth    SystemUpdateBandwidth         `json:"bandwidth"              yaml:"bandwidth"`
+}
+
+// SystemUpdateStatus represents the current step of the update process.
+type SystemUpdateStatus string
+
+const (
+	// SystemUpdateStatusIdle is used when no update is in progress.
+	SystemUpdateStatusIdle SystemUpdateStatus = "idle"
+
+	// SystemUpdateStatusChecking is used while looking for updates.
+	SystemUpdateStatusChecking SystemUpdateStatus = "checking"
+
+	// SystemUpdateStatusDownloading is used while downloading updates.
+	SystemUpdateStatusDownloading SystemUpdateStatus = "downloading"
+
+	// SystemUpdateStatusStaged is used once updates are downloaded but not yet applied.
+	SystemUpdateStatusStaged SystemUpdateStatus = "staged"
+
+	// SystemUpdateStatusApplying is used while updates are being applied.
+	SystemUpdateStatusApplying SystemUpdateStatus = "applying"
+
+	// SystemUpdateStatusPendingReboot is used once an OS update requires a reboot.
+	SystemUpdateStatusPendingReboot SystemUpdateStatus = "pending-reboot"
+
+	// SystemUpdateStatusFailed is used when the last update attempt failed.
+	SystemUpdateStatusFailed SystemUpdateStatus = "failed"
+)
+
+// SystemUpdateAsset holds the download progress of a release asset.
+type SystemUpdateAsset struct {
+	Name    string `json:"name"    yaml:"name"`
+	Version string `json:"version" yaml:"version"`
+
+	// Bytes downloaded so far and total size of the asset (-1 if unknown).
+	BytesDownloaded int64 `json:"bytes_downloaded" yaml:"bytes_downloaded"`
+	BytesTotal      int64 `json:"bytes_total"      yaml:"bytes_total"`
+}
+
+// SystemUpdateProgress holds the download progress of an update, aggregated over all its assets.
+type SystemUpdateProgress struct {
+	// Component being downloaded (OS or application name) and its version.
+	Component string `json:"component" yaml:"component"`
+	Version   string `json:"version"   yaml:"version"`
+
+	// Bytes downloaded so far and total size of the update (-1 if unknown).
+	BytesDownloaded int64 `json:"bytes_downloaded" yaml:"bytes_downloaded"`
+	BytesTotal      int64 `json:"bytes_total"      yaml:"bytes_total"`
+
+	// Current download rate in bytes per second.
+	Rate int64 `json:"rate" yaml:"rate"`
+
+	// Estimated number of seconds until the download completes (-1 if unknown).
+	ETA int64 `json:"eta" yaml:"eta"`
+}
+
+// SystemUpdatePut is used to modify the update configuration or trigger an update action.
+type SystemUpdatePut struct {
+	// Config replaces the current configuration when set.
+	Config *SystemUpdateConfig `json:"config,omitempty" yaml:"config,omitempty"`
+
+	// Action is either "check" to check for updates, or "apply" to reboot into a staged OS update.
+	Action string `json:"action,omitempty" yaml:"action,omitempty"`
+}
+
+// SystemUpdateDryRunComponent describes what an update check would do for a single component.
+type SystemUpdateDryRunComponent struct {
+	CurrentVersion   string `json:"current_version"   yaml:"current_version"`
+	AvailableVersion string `json:"available_version" yaml:"available_version"`
+	Provider         string `json:"provider"          yaml:"provider"`
+
+	// Number of bytes to download (-1 if unknown), zero when nothing would be downloaded.
+	DownloadSize int64 `json:"download_size" yaml:"download_size"`
+
+	// Whether the available release would be installed and whether that requires a reboot.
+	Update         bool `json:"update"          yaml:"update"`
+	RebootRequired bool `json:"reboot_required" yaml:"reboot_required"`
+
+	// Reason the available release is skipped ("held", "problematic", "older than local"), if any.
+	SkippedReason string `json:"skipped_reason,omitempty" yaml:"skipped_reason,omitempty"`
+}
+
+// SystemUpdateDryRun holds the result of an update check which doesn't download or apply anything.
+type SystemUpdateDryRun struct {
+	OS           SystemUpdateDryRunComponent            `json:"os"           yaml:"os"`
+	Applications map[string]SystemUpdateDryRunComponent `json:"applications" yaml:"applications"`
+}
+
+// SystemUpdate defines a struct to hold information about the system's update policy and status.
+type SystemUpdate struct {
+	Config SystemUpdateConfig `json:"config" yaml:"config"`
+
+	State struct {
+		Status    SystemUpdateStatus  `json:"status"     yaml:"status"`
+		Provider  string              `json:"provider"   yaml:"provider"`
+		LastCheck time.Time           `json:"last_check" yaml:"last_check"`
+		LastError string              `json:"last_error" yaml:"last_error"`
+		Assets    []SystemUpdateAsset `json:"assets"     yaml:"assets"`
+
+		// Overall progress of the update being downloaded, if any.
+		Progress *SystemUpdateProgress `json:"progress,omitempty" yaml:"progress,omitempty"`
+
+		// OS releases which failed to boot and won't be automatically retried.
+		FailedOSReleases []string `json:"failed_os_releases" yaml:"failed_os_releases"`
+
+		// Application releases which failed and were rolled back, keyed by application name.
+		FailedApplicationReleases map[string][]string `json:"failed_application_releases" yaml:"failed_application_releases"`
+
+		// Start of the next window for each action, the current time if the window is open.
+		NextDownload          *time.Time `json:"next_download,omitempty"           yaml:"next_download,omitempty"`
+		NextApplyApplications *time.Time `json:"next_apply_applications,omitempty" yaml:"next_apply_applications,omitempty"`
+		NextReboot            *time.Time `json:"next_reboot,omitempty"             yaml:"next_reboot,omitempty"`
+
+		// Images kept on disk for each application and for the OS, along with their combined size.
+		RetainedApplications map[string][]SystemUpdateRetainedImage `json:"retained_applications,omitempty" yaml:"retained_applications,omitempty"`
+		RetainedOS           []SystemUpdateRetainedImage            `json:"retained_os,omitempty"           yaml:"retained_os,omitempty"`
+		RetainedSize         int64                                  `json:"retained_size"                   yaml:"retained_size"`
+	} `json:"state" yaml:"state"`
+}
@@ -9,14 +9,17 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"golang.org/x/sys/unix"
 
+	"github.com/lxc/incus-os/incus-osd/api"
 	"github.com/lxc/incus-os/incus-osd/internal/applications"
 	"github.com/lxc/incus-os/incus-osd/internal/install"
 	"github.com/lxc/incus-os/incus-osd/internal/keyring"
+	"github.com/lxc/incus-os/incus-osd/internal/maintenance"
 	"github.com/lxc/incus-os/incus-osd/internal/providers"
 	"github.com/lxc/incus-os/incus-osd/internal/rest"
 	"github.com/lxc/incus-os/incus-osd/internal/seed"
@@ -30,8 +33,25 @@ import (
 var (
 	varPath = "/var/lib/incus-os/"
 	runPath = "/run/incus-os/"
+
+	// bootAssessmentTimeout is how long a newly booted image has to pass its health checks.
+	bootAssessmentTimeout = 15 * time.Minute
 )
 
+// healthCheckError is returned by the startup steps whose failure points to a bad OS image, as opposed
+// to a configuration or environment problem which rolling back wouldn't fix.
+type healthCheckError struct {
+	err error
+}
+
+func (e healthCheckError) Error() string {
+	return e.err.Error()
+}
+
+func (e healthCheckError) Unwrap() error {
+	return e.err
+}
+
 func main() {
 	ctx := context.Background()
 
@@ -72,6 +92,11 @@ func main() {
 	s.OS.Name = osName
 	s.OS.RunningRelease = osRelease
 
+	// Throttle downloads as configured.
+	providers.DownloadRateLimit = func() int64 {
+		return downloadRateLimit(s)
+	}
+
 	// Perform the install check here, so we don't render the TUI footer during install.
 	s.ShouldPerformInstall = install.ShouldPerformInstall()
 
@@ -132,18 +157,47 @@ func run(ctx context.Context, s *state.State, t *tui.TUI) error {
 		return inst.DoInstall(ctx, s.OS.Name)
 	}
 
+	// Check if the boot loader is waiting for this boot to be assessed.
+	assessment, err := systemd.GetBootAssessment(ctx)
+	if err != nil {
+		slog.Warn("Unable to get the boot assessment status", "err", err.Error())
+	}
+
+	isBootAssessed := assessment == systemd.BootAssessmentIndeterminate
+
 	// Run startup tasks.
-	err = startup(ctx, s, t)
+	ps, err := startup(ctx, s, t, isBootAssessed)
 	if err != nil {
+		if isBootAssessed && errors.As(err, &healthCheckError{}) {
+			rollbackBoot(ctx, s, err)
+		}
+
 		return err
 	}
 
 	// Start the API.
-	server, err := rest.NewServer(ctx, s, filepath.Join(runPath, "unix.socket"))
+	server, err := rest.NewServer(ctx, s, filepath.Join(runPath, "unix.socket"), ps)
 	if err != nil {
+		if isBootAssessed {
+			rollbackBoot(ctx, s, err)
+		}
+
 		return err
 	}
 
+	// All health checks have passed, mark the boot as good.
+	if isBootAssessed {
+		err = systemd.MarkBootGood(ctx)
+		if err != nil {
+			slog.Error("Failed to mark the boot as good", "err", err.Error())
+		} else {
+			slog.Info("Boot marked as good", "release", s.OS.RunningRelease)
+		}
+	}
+
+	// Serve downloaded release files to peers when configured.
+	go updatePeerCache(ctx, s)
+
 	// Done with all initialization.
 	slog.Info("System is ready", "release", s.OS.RunningRelease)
 
@@ -197,7 +251,7 @@ func shutdown(ctx context.Context, s *state.State, t *tui.TUI) error {
 	return nil
 }
 
-func startup(ctx context.Context, s *state.State, t *tui.TUI) error {
+func startup(ctx context.Context, s *state.State, t *tui.TUI, isBootAssessed bool) ([]providers.Provider, error) {
 	// Save state on exit.
 	defer func() { _ = s.Save(ctx) }()
 
@@ -205,11 +259,11 @@ func startup(ctx context.Context, s *state.State, t *tui.TUI) error {
 	slog.Debug("Getting trusted system keys")
 	keys, err := keyring.GetKeys(ctx, keyring.PlatformKeyring)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(keys) == 0 {
-		return errors.New("invalid Secure Boot environment detected, no platform keys loaded")
+		return nil, errors.New("invalid Secure Boot environment detected, no platform keys loaded")
 	}
 
 	// Determine runtime mode.
@@ -231,22 +285,51 @@ func startup(ctx context.Context, s *state.State, t *tui.TUI) error {
 	if len(s.System.Encryption.Config.RecoveryKeys) == 0 {
 		err := systemd.GenerateRecoveryKey(ctx, s)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	slog.Info("System is starting up", "mode", mode, "release", s.OS.RunningRelease)
 
-	// Display a warning if we're running from the backup image.
-	if s.OS.NextRelease != "" && s.OS.RunningRelease != s.OS.NextRelease {
-		slog.Warn("Booted from backup " + s.OS.Name + " image version " + s.OS.RunningRelease)
+	// Check whether the staged OS update got booted into.
+	if s.OS.NextRelease == "" || providers.SameVersion(s.OS.RunningRelease, s.OS.NextRelease) {
+		s.OS.PendingReboot = false
+	} else {
+		// Only consider the update as failed if the boot loader gave up on it, otherwise it's still pending a reboot.
+		isBootFailed, err := systemd.IsBootFailed(ctx, s.OS.Name, s.OS.NextRelease)
+		if err != nil {
+			slog.Warn("Unable to check the boot status of the staged OS update", "release", s.OS.NextRelease, "err", err.Error())
+		}
+
+		if isBootFailed {
+			// Display a warning if we're running from the backup image.
+			slog.Warn("Booted from backup " + s.OS.Name + " image version " + s.OS.RunningRelease)
+
+			s.OS.PendingReboot = false
+
+			if recordFailedRelease(s, s.OS.NextRelease) {
+				addHistory(s, api.SystemHistoryEntry{
+					Type:        api.SystemHistoryTypeRollback,
+					Outcome:     api.SystemHistoryOutcomeSuccess,
+					Component:   s.OS.Name,
+					FromVersion: s.OS.NextRelease,
+					ToVersion:   s.OS.RunningRelease,
+					Message:     "Booted from backup image",
+				})
+			}
+		}
+	}
+
+	// Any update still in progress was interrupted by the restart.
+	if s.System.Update.State.Status != api.SystemUpdateStatusFailed {
+		s.System.Update.State.Status = api.SystemUpdateStatusIdle
 	}
 
 	// If there's no network configuration in the state, attempt to fetch from the seed info.
 	if s.System.Network.Config == nil {
 		s.System.Network.Config, err = seed.GetNetwork(ctx, seed.SeedPartitionPath)
 		if err != nil && !seed.IsMissing(err) {
-			return err
+			return nil, err
 		}
 	}
 
@@ -254,7 +337,7 @@ func startup(ctx context.Context, s *state.State, t *tui.TUI) error {
 	slog.Info("Bringing up the network")
 	err = systemd.ApplyNetworkConfiguration(ctx, &s.System.Network, 30*time.Second)
 	if err != nil {
-		return err
+		return nil, healthCheckError{err}
 	}
 
 	// Get the provider.
@@ -267,7 +350,7 @@ func startup(ctx context.Context, s *state.State, t *tui.TUI) error {
 	case "dev":
 		provider = "local"
 	default:
-		return errors.New("currently unsupported operating mode")
+		return nil, errors.New("currently unsupported operating mode")
 	}
 
 	if s.System.Provider.Config.Name != "" {
@@ -276,38 +359,69 @@ func startup(ctx context.Context, s *state.State, t *tui.TUI) error {
 	} else {
 		providerSeed, err := seed.GetProvider(ctx, seed.SeedPartitionPath)
 		if err != nil && !seed.IsMissing(err) {
-			return err
+			return nil, err
 		}
 
 		if providerSeed != nil {
 			s.System.Provider.Config = providerSeed.SystemProviderConfig
 			provider = s.System.Provider.Config.Name
 			providerConfig = s.System.Provider.Config.Config
+
+			addHistory(s, api.SystemHistoryEntry{
+				Type:     api.SystemHistoryTypeProviderChange,
+				Outcome:  api.SystemHistoryOutcomeSuccess,
+				Provider: provider,
+				Message:  "Configured from seed",
+			})
 		}
 	}
 
-	p, err := providers.Load(ctx, provider, providerConfig)
+	p, err := providers.Load(ctx, s, provider, providerConfig)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	s.System.Provider.State.Channel = p.Channel()
+
+	// Get the fallback providers, skipping any which can't be loaded.
+	ps := []providers.Provider{p}
+
+	for _, fallback := range s.System.Provider.Config.Fallbacks {
+		fp, err := providers.Load(ctx, s, fallback.Name, fallback.Config)
+		if err != nil {
+			slog.Error("Failed to load fallback provider", "provider", fallback.Name, "err", err.Error())
+
+			continue
+		}
+
+		ps = append(ps, fp)
 	}
 
-	if p != nil {
-		// Perform an initial blocking check for updates before proceeding.
-		updateChecker(ctx, s, t, p, true, false)
+	// Perform an initial blocking check for updates before proceeding.
+	updateChecker(ctx, s, t, ps, true, false)
+
+	// Roll back to the previous image if the health checks don't complete in time.
+	stopBootAssessmentTimer := func() bool { return true }
+
+	if isBootAssessed {
+		timer := startBootAssessmentTimer(ctx, s.OS.RunningRelease)
+		stopBootAssessmentTimer = timer.Stop
+
+		defer timer.Stop()
 	}
 
 	// Ensure  the "local" ZFS pool is available.
 	slog.Info("Bringing up the local storage")
 	err = zfs.ImportOrCreateLocalPool(ctx)
 	if err != nil {
-		return err
+		return nil, healthCheckError{err}
 	}
 
 	// Run services startup actions.
 	for _, srvName := range services.ValidNames {
 		srv, err := services.Load(ctx, s, srvName)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if !srv.ShouldStart() {
@@ -318,7 +432,7 @@ func startup(ctx context.Context, s *state.State, t *tui.TUI) error {
 
 		err = srv.Start(ctx)
 		if err != nil {
-			return err
+			return nil, healthCheckError{err}
 		}
 	}
 
@@ -326,20 +440,34 @@ func startup(ctx context.Context, s *state.State, t *tui.TUI) error {
 	for appName := range s.Applications {
 		err := startInitializeApplication(ctx, s, appName)
 		if err != nil {
-			return err
+			return nil, healthCheckError{err}
 		}
 	}
 
-	// Run periodic update checks if we have a working provider.
-	if p != nil {
-		go updateChecker(ctx, s, t, p, false, false)
+	// The health checks are done, unless they already timed out.
+	if !stopBootAssessmentTimer() {
+		return nil, errors.New("startup health checks timed out")
+	}
+
+	// Restore applications evacuated ahead of the last reboot or shutdown, before the update checks
+	// get to modify them. This doesn't affect the health of the system itself, so failures are
+	// retried on the next startup instead.
+	err = restoreApplications(ctx, s)
+	if err != nil {
+		slog.Error("Failed to restore applications", "err", err.Error())
 	}
 
+	// Run periodic update checks until shutdown.
+	updateCtx, cancelUpdates := context.WithCancel(ctx)
+	go updateChecker(updateCtx, s, t, ps, false, false)
+
 	// Handle registration.
 	if !s.System.Provider.State.Registered {
 		err = p.Register(ctx)
 		if err != nil && !errors.Is(err, providers.ErrRegistrationUnsupported) {
-			return err
+			cancelUpdates()
+
+			return nil, err
 		}
 
 		if err == nil {
@@ -354,6 +482,7 @@ func startup(ctx context.Context, s *state.State, t *tui.TUI) error {
 	s.TriggerReboot = make(chan error, 1)
 	s.TriggerShutdown = make(chan error, 1)
 	s.TriggerUpdate = make(chan bool, 1)
+	s.TriggerBundleUpdate = make(chan bool, 1)
 	chSignal := make(chan os.Signal, 1)
 	signal.Notify(chSignal, unix.SIGTERM)
 	go func() {
@@ -368,9 +497,24 @@ func startup(ctx context.Context, s *state.State, t *tui.TUI) error {
 		case <-s.TriggerShutdown:
 			action = "shutdown"
 		case <-s.TriggerUpdate:
-			updateChecker(ctx, s, t, p, false, true)
+			updateChecker(ctx, s, t, ps, false, true)
 
 			goto waitSignal
+		case <-s.TriggerBundleUpdate:
+			applyUpdateBundle(ctx, s, t)
+
+			goto waitSignal
+		}
+
+		// Stop the periodic update checks.
+		cancelUpdates()
+
+		// Evacuate ahead of daemon initiated reboots and shutdowns.
+		if action != "exit" {
+			err := evacuateApplications(ctx, s)
+			if err != nil {
+				slog.Error("Failed to evacuate applications", "err", err.Error())
+			}
 		}
 
 		err := shutdown(ctx, s, t)
@@ -388,7 +532,157 @@ func startup(ctx context.Context, s *state.State, t *tui.TUI) error {
 		os.Exit(0) //nolint:revive
 	}()
 
-	return nil
+	return ps, nil
+}
+
+// rollbackApplication restores the previous image of an application after a failed update, records
+// the failed release so it doesn't get automatically retried and optionally restarts the application.
+func rollbackApplication(ctx context.Context, s *state.State, appName string, reason error, restart bool) error {
+	appInfo := s.Applications[appName]
+
+	slog.Error("Application update failed, rolling back", "application", appName, "release", appInfo.Version, "previous", appInfo.PreviousVersion, "err", reason.Error())
+
+	// Record the failed release.
+	if s.System.Update.State.FailedApplicationReleases == nil {
+		s.System.Update.State.FailedApplicationReleases = map[string][]string{}
+	}
+
+	if !slices.Contains(s.System.Update.State.FailedApplicationReleases[appName], appInfo.Version) {
+		s.System.Update.State.FailedApplicationReleases[appName] = append(s.System.Update.State.FailedApplicationReleases[appName], appInfo.Version)
+	}
+
+	_ = s.Save(ctx)
+
+	// Put the previous image back in place.
+	err := systemd.RestoreExtension(ctx, appName, appInfo.PreviousVersion)
+	if err != nil {
+		addHistory(s, api.SystemHistoryEntry{
+			Type:        api.SystemHistoryTypeRollback,
+			Outcome:     api.SystemHistoryOutcomeFailure,
+			Component:   appName,
+			FromVersion: appInfo.Version,
+			ToVersion:   appInfo.PreviousVersion,
+			Provider:    s.System.Provider.State.ApplicationProviders[appName],
+			Message:     err.Error(),
+		})
+
+		return err
+	}
+
+	addHistory(s, api.SystemHistoryEntry{
+		Type:        api.SystemHistoryTypeRollback,
+		Outcome:     api.SystemHistoryOutcomeSuccess,
+		Component:   appName,
+		FromVersion: appInfo.Version,
+		ToVersion:   appInfo.PreviousVersion,
+		Provider:    s.System.Provider.State.ApplicationProviders[appName],
+		Message:     reason.Error(),
+	})
+
+	appInfo.Version = appInfo.PreviousVersion
+	appInfo.PreviousVersion = ""
+	s.Applications[appName] = appInfo
+	_ = s.Save(ctx)
+
+	err = systemd.RefreshExtensions(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !restart {
+		return nil
+	}
+
+	// Restart the application on its previous release.
+	app, err := applications.Load(ctx, appName)
+	if err != nil {
+		return err
+	}
+
+	if app.IsRunning(ctx) {
+		return app.Update(ctx, appInfo.Version)
+	}
+
+	return startInitializeApplication(ctx, s, appName)
+}
+
+// rollbackBoot marks the current boot as bad, records the failed release and reboots into the previous image.
+func rollbackBoot(ctx context.Context, s *state.State, reason error) {
+	slog.Error("System failed its startup health checks, rolling back to the previous image", "release", s.OS.RunningRelease, "err", reason.Error())
+
+	recordFailedRelease(s, s.OS.RunningRelease)
+	_ = s.Save(ctx)
+
+	err := systemd.MarkBootBad(ctx)
+	if err != nil {
+		slog.Error("Failed to mark the boot as bad", "err", err.Error())
+
+		addHistory(s, api.SystemHistoryEntry{
+			Type:        api.SystemHistoryTypeRollback,
+			Outcome:     api.SystemHistoryOutcomeFailure,
+			Component:   s.OS.Name,
+			FromVersion: s.OS.RunningRelease,
+			Provider:    s.System.Provider.State.OSProvider,
+			Message:     err.Error(),
+		})
+
+		return
+	}
+
+	addHistory(s, api.SystemHistoryEntry{
+		Type:        api.SystemHistoryTypeRollback,
+		Outcome:     api.SystemHistoryOutcomeSuccess,
+		Component:   s.OS.Name,
+		FromVersion: s.OS.RunningRelease,
+		Provider:    s.System.Provider.State.OSProvider,
+		Message:     reason.Error(),
+	})
+
+	err = systemd.SystemReboot(ctx)
+	if err != nil {
+		slog.Error("Failed to reboot", "err", err.Error())
+	}
+}
+
+// startBootAssessmentTimer reboots into the previous image if the health checks don't complete in time.
+// As startup may still be running, only the boot loader is involved. The failed release then gets recorded
+// once booted into the previous image.
+func startBootAssessmentTimer(ctx context.Context, release string) *time.Timer {
+	return time.AfterFunc(bootAssessmentTimeout, func() {
+		slog.Error("System didn't pass its startup health checks in time, rolling back to the previous image", "release", release)
+
+		err := systemd.MarkBootBad(ctx)
+		if err != nil {
+			slog.Error("Failed to mark the boot as bad", "err", err.Error())
+
+			return
+		}
+
+		err = systemd.SystemReboot(ctx)
+		if err != nil {
+			slog.Error("Failed to reboot", "err", err.Error())
+		}
+	})
+}
+
+// recordFailedRelease records an OS release which failed to boot, so it doesn't get automatically retried.
+// Returns whether the release wasn't already recorded.
+func recordFailedRelease(s *state.State, release string) bool {
+	if slices.ContainsFunc(s.System.Update.State.FailedOSReleases, func(failed string) bool { return providers.SameVersion(failed, release) }) {
+		return false
+	}
+
+	s.System.Update.State.FailedOSReleases = append(s.System.Update.State.FailedOSReleases, release)
+
+	return true
+}
+
+// addHistory records an entry in the update and lifecycle history.
+func addHistory(s *state.State, entry api.SystemHistoryEntry) {
+	err := s.AddHistory(entry)
+	if err != nil {
+		slog.Error("Failed to record history", "err", err.Error())
+	}
 }
 
 func startInitializeApplication(ctx context.Context, s *state.State, appName string) error {
@@ -424,33 +718,98 @@ func startInitializeApplication(ctx context.Context, s *state.State, appName str
 	return nil
 }
 
-func updateChecker(ctx context.Context, s *state.State, t *tui.TUI, p providers.Provider, isStartupCheck bool, isUserRequested bool) {
+func updateChecker(ctx context.Context, s *state.State, t *tui.TUI, ps []providers.Provider, isStartupCheck bool, isUserRequested bool) {
 	var modal *tui.Modal
 
+	var checkErr error
+
 	showModalError := func(msg string, err error) {
-		slog.Error(msg, "err", err.Error(), "provider", p.Type())
+		checkErr = fmt.Errorf("%s: %w", msg, err)
+		setUpdateError(ctx, s, checkErr)
+
+		slog.Error(msg, "err", err.Error(), "provider", providerNames(ps))
 		if modal == nil {
 			modal = t.AddModal(s.OS.Name + " Update")
 		}
-		modal.Update("[red]Error[white] " + msg + ": " + err.Error() + " (provider: " + p.Type() + ")")
+		modal.Update("[red]Error[white] " + msg + ": " + err.Error() + " (provider: " + providerNames(ps) + ")")
+	}
+
+	rollBack := func(appName string, msg string, err error, restart bool) {
+		previousVersion := s.Applications[appName].PreviousVersion
+
+		rollbackErr := rollbackApplication(ctx, s, appName, err, restart)
+		if rollbackErr != nil {
+			showModalError(msg, err)
+			showModalError("Failed to roll back application "+appName, rollbackErr)
+
+			return
+		}
+
+		showModalError(msg+" (rolled back "+appName+" to version "+previousVersion+")", err)
+	}
+
+	// Get the interval between periodic checks.
+	interval, err := providers.CheckInterval(ps[0].Type(), s.System.Provider.Config.Config)
+	if err != nil {
+		interval = providers.DefaultCheckInterval
 	}
 
+	failures := 0
+
 	for {
 		// Sleep at the top of each loop, except if we're performing a startup check.
 		if !isStartupCheck && !isUserRequested {
-			time.Sleep(6 * time.Hour)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(updateCheckDelay(s, interval, failures)):
+			}
+
+			// Reboot into a staged OS update if within the maintenance window.
+			checkDoReboot(ctx, s)
+
+			// Periodic checks only run during the download maintenance window.
+			allowed, err := maintenance.IsAllowed(s.System.Update.Config.Maintenance, maintenance.ActionDownload, time.Now())
+			if err != nil {
+				showModalError("Failed to check the maintenance windows", err)
+
+				continue
+			}
+
+			if !allowed {
+				slog.Debug("Outside of the download maintenance window, skipping update check")
+
+				continue
+			}
 		}
 
+		checkErr = nil
+
 		// If user requested, clear cache.
 		if isUserRequested {
-			err := p.ClearCache(ctx)
-			if err != nil {
-				slog.Error("Failed to clear provider cache", "err", err.Error())
+			var err error
+
+			for _, p := range ps {
+				err = p.ClearCache(ctx)
+				if err != nil {
+					slog.Error("Failed to clear provider cache", "err", err.Error(), "provider", p.Type())
+					setUpdateError(ctx, s, err)
 
+					break
+				}
+			}
+
+			if err != nil {
 				break
 			}
 		}
 
+		// Record the start of the check.
+		s.System.Update.State.LastCheck = time.Now()
+		s.System.Update.State.Assets = []api.SystemUpdateAsset{}
+		s.System.Update.State.Progress = nil
+		setUpdateStatus(ctx, s, api.SystemUpdateStatusChecking)
+
 		// Determine what applications to install.
 		toInstall := []string{"incus"}
 
@@ -459,6 +818,7 @@ func updateChecker(ctx context.Context, s *state.State, t *tui.TUI, p providers.
 			apps, err := seed.GetApplications(ctx, seed.SeedPartitionPath)
 			if err != nil && !seed.IsMissing(err) {
 				slog.Error("Failed to get application list", "err", err.Error())
+				setUpdateError(ctx, s, err)
 
 				if isStartupCheck || isUserRequested {
 					break
@@ -484,16 +844,41 @@ func updateChecker(ctx context.Context, s *state.State, t *tui.TUI, p providers.
 			}
 		}
 
-		// Check for the latest OS update.
-		newInstalledOSVersion, err := checkDoOSUpdate(ctx, s, t, p, isStartupCheck)
-		if err != nil {
-			showModalError("Failed to check for OS updates", err)
+		// Outside of the download maintenance window, the startup check only installs missing applications.
+		downloadAllowed := true
 
-			if isStartupCheck || isUserRequested {
-				break
+		if isStartupCheck {
+			downloadAllowed, err = maintenance.IsAllowed(s.System.Update.Config.Maintenance, maintenance.ActionDownload, time.Now())
+			if err != nil {
+				showModalError("Failed to check the maintenance windows", err)
 			}
 
-			continue
+			if !downloadAllowed {
+				slog.Debug("Outside of the download maintenance window, skipping updates")
+			}
+		}
+
+		// Check for the latest OS update.
+		newInstalledOSVersion := ""
+
+		if downloadAllowed {
+			newInstalledOSVersion, err = checkDoOSUpdate(ctx, s, t, ps, isStartupCheck)
+			if err != nil {
+				showModalError("Failed to check for OS updates", err)
+
+				// Retry sooner on transient failures.
+				if providers.IsUnavailable(err) {
+					failures++
+				} else {
+					failures = 0
+				}
+
+				if isStartupCheck || isUserRequested {
+					break
+				}
+
+				continue
+			}
 		}
 
 		if newInstalledOSVersion != "" {
@@ -505,10 +890,33 @@ func updateChecker(ctx context.Context, s *state.State, t *tui.TUI, p providers.
 
 		// Check for application updates.
 		appsUpdated := map[string]string{}
+		transientFailure := false
+
 		for _, appName := range toInstall {
-			newAppVersion, err := checkDoAppUpdate(ctx, s, t, p, appName, isStartupCheck)
+			if !downloadAllowed && s.Applications[appName].Version != "" {
+				continue
+			}
+
+			// Installed applications are only updated during the maintenance window.
+			if !isStartupCheck && !isUserRequested && s.Applications[appName].Version != "" {
+				allowed, err := maintenance.IsAllowed(s.System.Update.Config.Maintenance, maintenance.ActionApplyApplications, time.Now())
+				if err != nil {
+					showModalError("Failed to check the maintenance windows", err)
+
+					break
+				}
+
+				if !allowed {
+					slog.Debug("Outside of the application maintenance window, skipping update", "application", appName)
+
+					continue
+				}
+			}
+
+			newAppVersion, err := checkDoAppUpdate(ctx, s, t, ps, appName, isStartupCheck)
 			if err != nil {
 				showModalError("Failed to check for application updates", err)
+				transientFailure = providers.IsUnavailable(err)
 
 				break
 			}
@@ -520,11 +928,18 @@ func updateChecker(ctx context.Context, s *state.State, t *tui.TUI, p providers.
 
 		// Apply the system extensions.
 		if len(appsUpdated) > 0 {
+			setUpdateStatus(ctx, s, api.SystemUpdateStatusApplying)
+
 			slog.Debug("Refreshing system extensions")
 			err = systemd.RefreshExtensions(ctx)
 			if err != nil {
 				showModalError("Failed to refresh system extensions", err)
 
+				// Go back to the previous images.
+				for appName := range appsUpdated {
+					rollBack(appName, "Failed to refresh system extensions", err, false)
+				}
+
 				if isStartupCheck || isUserRequested {
 					break
 				}
@@ -550,18 +965,47 @@ func updateChecker(ctx context.Context, s *state.State, t *tui.TUI, p providers.
 
 					err := app.Update(ctx, appVersion)
 					if err != nil {
-						showModalError("Failed to reload application", err)
+						rollBack(appName, "Failed to reload application", err, true)
 
 						continue
 					}
 				} else {
 					err := startInitializeApplication(ctx, s, appName)
 					if err != nil {
-						showModalError("Failed to start application", err)
+						rollBack(appName, "Failed to start application", err, true)
 
 						continue
 					}
 				}
+
+				// Check that the application is running fine.
+				if !app.IsRunning(ctx) {
+					rollBack(appName, "Application failed after update", errors.New(appName+" isn't running"), true)
+
+					continue
+				}
+			}
+		}
+
+		// Retry sooner on transient failures.
+		if transientFailure {
+			failures++
+		} else {
+			failures = 0
+		}
+
+		// Remove images which aren't needed anymore.
+		err = pruneImages(ctx, s)
+		if err != nil {
+			showModalError("Failed to remove old images", err)
+		}
+
+		// Record the outcome of the check.
+		if checkErr == nil {
+			if s.OS.PendingReboot {
+				setUpdateStatus(ctx, s, api.SystemUpdateStatusPendingReboot)
+			} else {
+				setUpdateStatus(ctx, s, api.SystemUpdateStatusIdle)
 			}
 		}
 
@@ -572,12 +1016,395 @@ func updateChecker(ctx context.Context, s *state.State, t *tui.TUI, p providers.
 	}
 }
 
-func checkDoOSUpdate(ctx context.Context, s *state.State, t *tui.TUI, p providers.Provider, isStartupCheck bool) (string, error) {
+// setUpdateStatus records the current step of the update process.
+func setUpdateStatus(ctx context.Context, s *state.State, status api.SystemUpdateStatus) {
+	s.System.Update.State.Status = status
+	_ = s.Save(ctx)
+}
+
+// setUpdateError records a failed update attempt.
+func setUpdateError(ctx context.Context, s *state.State, err error) {
+	// Don't flood the history with the same failure on every retry.
+	if s.System.Update.State.Status != api.SystemUpdateStatusFailed || s.System.Update.State.LastError != err.Error() {
+		addHistory(s, api.SystemHistoryEntry{
+			Type:     api.SystemHistoryTypeUpdateCheck,
+			Outcome:  api.SystemHistoryOutcomeFailure,
+			Provider: s.System.Update.State.Provider,
+			Message:  err.Error(),
+		})
+	}
+
+	s.System.Update.State.LastError = err.Error()
+	setUpdateStatus(ctx, s, api.SystemUpdateStatusFailed)
+}
+
+// updateProgress returns a function recording the download progress of a release's assets,
+// both in the update state and in the TUI modal. The overall progress is aggregated over all
+// assets, using the total size of the release when known (-1 otherwise).
+func updateProgress(s *state.State, modal *tui.Modal, component string, version string, total int64) func(providers.Progress) {
+	tracker := providers.NewProgressTracker(total, func(p providers.UpdateProgress) {
+		modal.UpdateDownloadProgress(p.Fraction(), p.Rate, p.ETA)
+
+		s.System.Update.State.Progress = &api.SystemUpdateProgress{
+			Component:       component,
+			Version:         version,
+			BytesDownloaded: p.Bytes,
+			BytesTotal:      p.Total,
+			Rate:            p.Rate,
+			ETA:             int64(p.ETA.Seconds()),
+		}
+	})
+
+	return func(p providers.Progress) {
+		tracker.Update(p)
+
+		for i, asset := range s.System.Update.State.Assets {
+			if asset.Name == p.Asset && asset.Version == version {
+				s.System.Update.State.Assets[i].BytesDownloaded = p.Bytes
+				s.System.Update.State.Assets[i].BytesTotal = p.Total
+
+				return
+			}
+		}
+
+		s.System.Update.State.Assets = append(s.System.Update.State.Assets, api.SystemUpdateAsset{
+			Name:            p.Asset,
+			Version:         version,
+			BytesDownloaded: p.Bytes,
+			BytesTotal:      p.Total,
+		})
+	}
+}
+
+// addUpdateHistory records the outcome of an OS or application update.
+func addUpdateHistory(s *state.State, component string, fromVersion string, toVersion string, provider string, err error) {
+	entry := api.SystemHistoryEntry{
+		Type:        api.SystemHistoryTypeApplicationUpdate,
+		Outcome:     api.SystemHistoryOutcomeSuccess,
+		Component:   component,
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		Provider:    provider,
+	}
+
+	if component == s.OS.Name {
+		entry.Type = api.SystemHistoryTypeOSUpdate
+	}
+
+	if err != nil {
+		entry.Outcome = api.SystemHistoryOutcomeFailure
+		entry.Message = err.Error()
+	}
+
+	addHistory(s, entry)
+}
+
+// addProviderChangeHistory records a component being served by a different provider than before.
+func addProviderChangeHistory(s *state.State, component string, previousProvider string, provider string) {
+	if previousProvider == "" || previousProvider == provider {
+		return
+	}
+
+	addHistory(s, api.SystemHistoryEntry{
+		Type:      api.SystemHistoryTypeProviderChange,
+		Outcome:   api.SystemHistoryOutcomeSuccess,
+		Component: component,
+		Provider:  provider,
+		Message:   "Previously served by " + previousProvider,
+	})
+}
+
+// pruneImages removes the images of applications which aren't installed anymore, along with
+// those past the configured retention. The installed and previous releases are always kept.
+func pruneImages(ctx context.Context, s *state.State) error {
+	installed := map[string][]string{}
+	for appName, appInfo := range s.Applications {
+		installed[appName] = []string{appInfo.Version, appInfo.PreviousVersion}
+	}
+
+	keep := s.System.Update.Config.Retention.Applications
+	if keep == 0 {
+		keep = 2
+	}
+
+	err := systemd.PruneExtensions(ctx, installed, keep)
+	if err != nil {
+		return err
+	}
+
+	return systemd.PruneOSUpdates(ctx, s.System.Update.Config.Retention.OS)
+}
+
+// downloadRateLimit returns the download rate limit currently applying, in bytes per second.
+func downloadRateLimit(s *state.State) int64 {
+	limit, err := maintenance.BandwidthLimit(s.System.Update.Config.Bandwidth, time.Now())
+	if err != nil {
+		slog.Warn("Failed to get the download rate limit", "err", err.Error())
+
+		return 0
+	}
+
+	return limit
+}
+
+// updatePeerCache applies the peer cache configuration, checking for changes every minute.
+func updatePeerCache(ctx context.Context, s *state.State) {
+	server := &providers.PeerCacheServer{}
+
+	for {
+		cfg := s.System.Update.Config.PeerCache
+
+		err := server.Update(ctx, cfg.Enabled, cfg.Address)
+		if err != nil {
+			slog.Error("Failed to update the peer update cache", "err", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Minute):
+		}
+	}
+}
+
+// updateCheckDelay returns how long to wait until the next periodic update check, waking up
+// early when a relevant maintenance window opens.
+func updateCheckDelay(s *state.State, interval time.Duration, failures int) time.Duration {
+	now := time.Now()
+	delay := providers.CheckDelay(interval, failures)
+
+	actions := []maintenance.Action{maintenance.ActionDownload}
+	if s.OS.PendingReboot {
+		actions = append(actions, maintenance.ActionReboot)
+	}
+
+	for _, action := range actions {
+		next, err := maintenance.NextWindow(s.System.Update.Config.Maintenance, action, now)
+		if err != nil || !next.After(now) {
+			continue
+		}
+
+		delay = min(delay, next.Sub(now))
+	}
+
+	return delay
+}
+
+// checkDoReboot reboots into a staged OS update once the reboot maintenance window opens.
+// Without any reboot window, the system waits for the user to reboot it.
+func checkDoReboot(ctx context.Context, s *state.State) {
+	if !s.OS.PendingReboot || len(s.System.Update.Config.Maintenance.Reboot) == 0 {
+		return
+	}
+
+	allowed, err := maintenance.IsAllowed(s.System.Update.Config.Maintenance, maintenance.ActionReboot, time.Now())
+	if err != nil {
+		slog.Error("Failed to check the reboot maintenance window", "err", err.Error())
+
+		return
+	}
+
+	if !allowed {
+		slog.Debug("OS update is pending, waiting for the reboot maintenance window", "release", s.OS.NextRelease)
+
+		return
+	}
+
+	// Evacuate ahead of the reboot, retrying later if another cluster member is currently rebooting.
+	err = evacuateApplications(ctx, s)
+	if err != nil {
+		slog.Error("Failed to evacuate applications, delaying reboot", "err", err.Error())
+
+		err = restoreApplications(ctx, s)
+		if err != nil {
+			slog.Error("Failed to restore applications", "err", err.Error())
+		}
+
+		return
+	}
+
+	slog.Info("Rebooting into OS update", "release", s.OS.NextRelease)
+
+	addHistory(s, api.SystemHistoryEntry{
+		Type:        api.SystemHistoryTypeReboot,
+		Outcome:     api.SystemHistoryOutcomeSuccess,
+		Component:   s.OS.Name,
+		FromVersion: s.OS.RunningRelease,
+		ToVersion:   s.OS.NextRelease,
+		Message:     "Applying staged OS update during the maintenance window",
+	})
+
+	select {
+	case s.TriggerReboot <- nil:
+	default:
+	}
+}
+
+// evacuateApplications prepares the applications for a daemon initiated reboot or shutdown,
+// recording which ones need to be restored on the following startup.
+func evacuateApplications(ctx context.Context, s *state.State) error {
+	for appName, appInfo := range s.Applications {
+		if appInfo.Evacuated {
+			continue
+		}
+
+		// Get the application.
+		app, err := applications.Load(ctx, appName)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("Evacuating application", "name", appName)
+
+		err = app.Evacuate(ctx)
+		if err != nil {
+			return err
+		}
+
+		appInfo.Evacuated = true
+		s.Applications[appName] = appInfo
+		_ = s.Save(ctx)
+	}
+
+	return nil
+}
+
+// restoreApplications restores the applications evacuated ahead of a reboot or shutdown.
+func restoreApplications(ctx context.Context, s *state.State) error {
+	for appName, appInfo := range s.Applications {
+		if !appInfo.Evacuated {
+			continue
+		}
+
+		// Get the application.
+		app, err := applications.Load(ctx, appName)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("Restoring application", "name", appName)
+
+		err = app.Restore(ctx)
+		if err != nil {
+			return err
+		}
+
+		appInfo.Evacuated = false
+		s.Applications[appName] = appInfo
+		_ = s.Save(ctx)
+	}
+
+	return nil
+}
+
+func applyUpdateBundle(ctx context.Context, s *state.State, t *tui.TUI) {
+	// Keep uploads from replacing the bundle while it's being applied, removing it once processed.
+	release, err := providers.AcquireBundle(ctx)
+	if err != nil {
+		slog.Error("Failed to acquire the update bundle", "err", err.Error())
+
+		return
+	}
+
+	defer func() {
+		err := release()
+		if err != nil {
+			slog.Error("Failed to remove the update bundle", "err", err.Error())
+		}
+	}()
+
+	// Get the bundle provider.
+	p, err := providers.Load(ctx, s, "bundle", nil)
+	if err != nil {
+		slog.Error("Failed to load the update bundle", "err", err.Error())
+
+		return
+	}
+
+	// Apply the bundle through the normal update logic.
+	updateChecker(ctx, s, t, []providers.Provider{p}, false, true)
+}
+
+// providerNames returns a printable list of provider types.
+func providerNames(ps []providers.Provider) string {
+	names := make([]string, 0, len(ps))
+	for _, p := range ps {
+		names = append(names, p.Type())
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// getOSUpdate tries each provider in turn, moving on to the next one when a provider can't be reached.
+// An empty version gets the latest release.
+func getOSUpdate(ctx context.Context, s *state.State, ps []providers.Provider, version string) (providers.OSUpdate, providers.Provider, error) {
+	var err error
+
+	for _, p := range ps {
+		var update providers.OSUpdate
+
+		update, err = p.GetOSUpdate(ctx, s.OS.Name, version)
+		if err == nil {
+			return update, p, nil
+		}
+
+		if !providers.IsUnavailable(err) {
+			return nil, nil, err
+		}
+
+		slog.Warn("Provider is currently unavailable", "provider", p.Type(), "err", err.Error())
+	}
+
+	return nil, nil, err
+}
+
+// getApplication tries each provider in turn, moving on to the next one when a provider can't be reached.
+// An empty version gets the latest release.
+func getApplication(ctx context.Context, ps []providers.Provider, appName string, version string) (providers.Application, providers.Provider, error) {
+	var err error
+
+	for _, p := range ps {
+		var app providers.Application
+
+		app, err = p.GetApplication(ctx, appName, version)
+		if err == nil {
+			return app, p, nil
+		}
+
+		if !providers.IsUnavailable(err) {
+			return nil, nil, err
+		}
+
+		slog.Warn("Provider is currently unavailable", "provider", p.Type(), "err", err.Error())
+	}
+
+	return nil, nil, err
+}
+
+func checkDoOSUpdate(ctx context.Context, s *state.State, t *tui.TUI, ps []providers.Provider, isStartupCheck bool) (string, error) {
 	slog.Debug("Checking for OS updates")
 
-	update, err := p.GetOSUpdate(ctx, s.OS.Name)
+	// Remove any stale partial downloads.
+	err := providers.CleanupStaging(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Check if the OS is being held.
+	policy := s.System.Update.Config.OS
+	if policy.Hold {
+		slog.Debug("OS updates are on hold", "release", s.OS.RunningRelease)
+
+		return "", nil
+	}
+
+	update, p, err := getOSUpdate(ctx, s, ps, policy.Version)
 	if err != nil {
 		if errors.Is(err, providers.ErrNoUpdateAvailable) {
+			if policy.Version != "" {
+				return "", errors.New("pinned " + s.OS.Name + " version " + policy.Version + " isn't available")
+			}
+
 			slog.Warn("OS update provider is currently unavailable")
 
 			return "", nil
@@ -586,49 +1413,125 @@ func checkDoOSUpdate(ctx context.Context, s *state.State, t *tui.TUI, p provider
 		return "", err
 	}
 
-	// If we're running from the backup image don't attempt to re-update to a broken version.
-	if s.OS.NextRelease != "" && s.OS.RunningRelease != s.OS.NextRelease && s.OS.NextRelease == update.Version() {
+	// The version ends up in file paths, so only accept valid ones.
+	_, err = providers.ParseVersion(update.Version())
+	if err != nil {
+		return "", err
+	}
+
+	// If we're running from the backup image don't attempt to re-update to a broken version, unless explicitly pinned.
+	if policy.Version == "" && !s.OS.PendingReboot && s.OS.NextRelease != "" && !providers.SameVersion(s.OS.RunningRelease, s.OS.NextRelease) && providers.SameVersion(s.OS.NextRelease, update.Version()) {
 		slog.Warn("Latest " + s.OS.Name + " image version " + s.OS.NextRelease + " has been identified as problematic, skipping update")
 
 		return "", nil
 	}
 
-	// Skip any update that isn't newer than what we are already running.
-	if s.OS.RunningRelease != update.Version() && !update.IsNewerThan(s.OS.RunningRelease) {
-		return "", errors.New("local " + s.OS.Name + " version (" + s.OS.RunningRelease + ") is newer than available update (" + update.Version() + "); skipping")
+	// Never automatically retry a release which previously failed to boot. Pinning it again clears the failure.
+	if slices.ContainsFunc(s.System.Update.State.FailedOSReleases, func(release string) bool { return providers.SameVersion(release, update.Version()) }) {
+		slog.Warn(s.OS.Name + " image version " + update.Version() + " previously failed to boot, skipping update")
+
+		return "", nil
+	}
+
+	// Skip any update that isn't newer than what we are already running, unless a specific version was pinned.
+	if policy.Version == "" && !providers.SameVersion(s.OS.RunningRelease, update.Version()) {
+		isNewer, err := update.IsNewerThan(s.OS.RunningRelease)
+		if err != nil {
+			return "", fmt.Errorf("unable to compare local %s version with available update: %w", s.OS.Name, err)
+		}
+
+		if !isNewer {
+			return "", errors.New("local " + s.OS.Name + " version (" + s.OS.RunningRelease + ") is newer than available update (" + update.Version() + "); skipping")
+		}
 	}
 
 	// Apply the update.
-	if update.Version() != s.OS.RunningRelease && update.Version() != s.OS.NextRelease {
-		// Download the update into place.
+	if !providers.SameVersion(update.Version(), s.OS.RunningRelease) && !providers.SameVersion(update.Version(), s.OS.NextRelease) {
 		modal := t.AddModal(s.OS.Name + " Update")
-		slog.Info("Downloading OS update", "release", update.Version())
-		modal.Update("Downloading " + s.OS.Name + " update version " + update.Version())
-		err := update.Download(ctx, s.OS.Name, systemd.SystemUpdatesPath, modal.UpdateProgress)
-		if err != nil {
-			return "", err
+
+		// Use the retained update if there's one, otherwise download the update into place.
+		err := systemd.RestoreOSUpdate(ctx, update.Version())
+		if err == nil {
+			slog.Info("Using retained OS update", "release", update.Version())
+		} else {
+			if !errors.Is(err, systemd.ErrImageNotRetained) {
+				return "", err
+			}
+
+			slog.Info("Downloading OS update", "release", update.Version())
+			modal.Update("Downloading " + s.OS.Name + " update version " + update.Version())
+			s.System.Update.State.Provider = p.Type()
+			setUpdateStatus(ctx, s, api.SystemUpdateStatusDownloading)
+
+			// Get the total size for progress reporting.
+			total, err := update.DownloadSize(ctx, s.OS.Name)
+			if err != nil {
+				slog.Warn("Failed to get the OS update size", "err", err.Error())
+
+				total = -1
+			}
+
+			err = update.Download(ctx, s.OS.Name, systemd.SystemUpdatesPath, updateProgress(s, modal, s.OS.Name, update.Version(), total))
+			if err != nil {
+				addUpdateHistory(s, s.OS.Name, s.OS.RunningRelease, update.Version(), p.Type(), err)
+
+				return "", err
+			}
+
+			// Keep the update around if configured to.
+			if s.System.Update.Config.Retention.OS > 0 {
+				err = systemd.RetainOSUpdate(ctx, update.Version())
+				if err != nil {
+					return "", err
+				}
+			}
 		}
 
+		setUpdateStatus(ctx, s, api.SystemUpdateStatusStaged)
+
 		// Hide the progress bar.
 		modal.UpdateProgress(0.0)
 
 		// Record the release. Need to do it here, since if the system reboots as part of the
 		// update we won't be able to save the state to disk.
 		priorNextRelease := s.OS.NextRelease
+		priorProvider := s.System.Provider.State.OSProvider
 		s.OS.NextRelease = update.Version()
-		_ = s.Save(ctx)
+		s.System.Provider.State.OSProvider = p.Type()
+		setUpdateStatus(ctx, s, api.SystemUpdateStatusApplying)
 
-		// Apply the update and reboot if first time through loop, otherwise wait for user to reboot system.
+		// Reboot right away during startup if the reboot maintenance window allows it, as applications
+		// aren't running yet. Otherwise leave the update staged for checkDoReboot or the user.
+		reboot := false
+
+		if isStartupCheck {
+			reboot, err = maintenance.IsAllowed(s.System.Update.Config.Maintenance, maintenance.ActionReboot, time.Now())
+			if err != nil {
+				slog.Error("Failed to check the reboot maintenance window", "err", err.Error())
+			}
+		}
+
+		// Apply the update.
 		slog.Info("Applying OS update", "release", update.Version())
 		modal.Update("Applying " + s.OS.Name + " update version " + update.Version())
-		err = systemd.ApplySystemUpdate(ctx, update.Version(), isStartupCheck)
+		err = systemd.ApplySystemUpdate(ctx, update.Version(), reboot)
 		if err != nil {
 			s.OS.NextRelease = priorNextRelease
+			s.System.Provider.State.OSProvider = priorProvider
 			_ = s.Save(ctx)
 
+			addUpdateHistory(s, s.OS.Name, s.OS.RunningRelease, update.Version(), p.Type(), err)
+
 			return "", err
 		}
 
+		addUpdateHistory(s, s.OS.Name, s.OS.RunningRelease, update.Version(), p.Type(), nil)
+		addProviderChangeHistory(s, s.OS.Name, priorProvider, p.Type())
+
+		if !reboot {
+			s.OS.PendingReboot = true
+		}
+
 		modal.Done()
 
 		return update.Version(), nil
@@ -639,12 +1542,30 @@ func checkDoOSUpdate(ctx context.Context, s *state.State, t *tui.TUI, p provider
 	return "", nil
 }
 
-func checkDoAppUpdate(ctx context.Context, s *state.State, t *tui.TUI, p providers.Provider, appName string, isStartupCheck bool) (string, error) {
+func checkDoAppUpdate(ctx context.Context, s *state.State, t *tui.TUI, ps []providers.Provider, appName string, isStartupCheck bool) (string, error) {
 	slog.Debug("Checking for application updates")
 
-	app, err := p.GetApplication(ctx, appName)
+	// Remove any stale partial downloads.
+	err := providers.CleanupStaging(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Check if the application is being held.
+	policy := s.System.Update.Config.Applications[appName]
+	if policy.Hold && s.Applications[appName].Version != "" {
+		slog.Debug("Application updates are on hold", "application", appName, "release", s.Applications[appName].Version)
+
+		return "", nil
+	}
+
+	app, p, err := getApplication(ctx, ps, appName, policy.Version)
 	if err != nil {
 		if errors.Is(err, providers.ErrNoUpdateAvailable) {
+			if policy.Version != "" {
+				return "", errors.New("pinned application " + appName + " version " + policy.Version + " isn't available")
+			}
+
 			slog.Warn("Application update provider is currently unavailable")
 
 			return "", nil
@@ -653,29 +1574,94 @@ func checkDoAppUpdate(ctx context.Context, s *state.State, t *tui.TUI, p provide
 		return "", err
 	}
 
+	// The version ends up in file paths, so only accept valid ones.
+	_, err = providers.ParseVersion(app.Version())
+	if err != nil {
+		return "", err
+	}
+
+	// Never automatically retry a release which previously failed. Pinning it again clears the failure.
+	if slices.ContainsFunc(s.System.Update.State.FailedApplicationReleases[appName], func(release string) bool { return providers.SameVersion(release, app.Version()) }) {
+		slog.Warn("Application "+appName+" version "+app.Version()+" previously failed, skipping update", "application", appName)
+
+		return "", nil
+	}
+
 	// Apply the update.
-	if app.Version() != s.Applications[app.Name()].Version {
-		if s.Applications[app.Name()].Version != "" && !app.IsNewerThan(s.Applications[app.Name()].Version) {
-			return "", errors.New("local application " + app.Name() + " version (" + s.Applications[app.Name()].Version + ") is newer than available update (" + app.Version() + "); skipping")
+	if !providers.SameVersion(app.Version(), s.Applications[app.Name()].Version) {
+		if policy.Version == "" && s.Applications[app.Name()].Version != "" {
+			isNewer, err := app.IsNewerThan(s.Applications[app.Name()].Version)
+			if err != nil {
+				return "", fmt.Errorf("unable to compare local application %s version with available update: %w", app.Name(), err)
+			}
+
+			if !isNewer {
+				return "", errors.New("local application " + app.Name() + " version (" + s.Applications[app.Name()].Version + ") is newer than available update (" + app.Version() + "); skipping")
+			}
 		}
 
-		// Download the application.
-		modal := t.AddModal(s.OS.Name + " Update")
-		slog.Info("Downloading application", "application", app.Name(), "release", app.Version())
-		modal.Update("Downloading application " + app.Name() + " update " + app.Version())
-		err = app.Download(ctx, systemd.SystemExtensionsPath, modal.UpdateProgress)
-		if err != nil {
-			return "", err
+		// Keep the current image around in case the update needs to be rolled back.
+		if s.Applications[app.Name()].Version != "" {
+			err = systemd.RetainExtension(ctx, app.Name(), s.Applications[app.Name()].Version)
+			if err != nil {
+				return "", err
+			}
 		}
 
-		modal.Done()
+		// Use the retained image if there's one, otherwise download the application.
+		err = systemd.RestoreExtension(ctx, app.Name(), app.Version())
+		if err == nil {
+			slog.Info("Using retained application image", "application", app.Name(), "release", app.Version())
+		} else {
+			if !errors.Is(err, systemd.ErrImageNotRetained) {
+				return "", err
+			}
+
+			modal := t.AddModal(s.OS.Name + " Update")
+			slog.Info("Downloading application", "application", app.Name(), "release", app.Version())
+			modal.Update("Downloading application " + app.Name() + " update " + app.Version())
+			s.System.Update.State.Provider = p.Type()
+			setUpdateStatus(ctx, s, api.SystemUpdateStatusDownloading)
+
+			// Get the total size for progress reporting.
+			total, err := app.DownloadSize(ctx)
+			if err != nil {
+				slog.Warn("Failed to get the application size", "application", app.Name(), "err", err.Error())
+
+				total = -1
+			}
+
+			err = app.Download(ctx, systemd.SystemExtensionsPath, updateProgress(s, modal, app.Name(), app.Version(), total))
+			if err != nil {
+				addUpdateHistory(s, app.Name(), s.Applications[app.Name()].Version, app.Version(), p.Type(), err)
+
+				return "", err
+			}
+
+			modal.Done()
+
+			err = systemd.RetainExtension(ctx, app.Name(), app.Version())
+			if err != nil {
+				return "", err
+			}
+		}
+
+		addUpdateHistory(s, app.Name(), s.Applications[app.Name()].Version, app.Version(), p.Type(), nil)
+		addProviderChangeHistory(s, app.Name(), s.System.Provider.State.ApplicationProviders[app.Name()], p.Type())
 
 		// Record newly installed application and save state to disk.
 		newAppInfo := s.Applications[app.Name()]
+		newAppInfo.PreviousVersion = newAppInfo.Version
 		newAppInfo.Version = app.Version()
 
 		s.Applications[app.Name()] = newAppInfo
-		_ = s.Save(ctx)
+
+		if s.System.Provider.State.ApplicationProviders == nil {
+			s.System.Provider.State.ApplicationProviders = map[string]string{}
+		}
+
+		s.System.Provider.State.ApplicationProviders[app.Name()] = p.Type()
+		setUpdateStatus(ctx, s, api.SystemUpdateStatusStaged)
 
 		return app.Version(), nil
 	} else if isStartupCheck {
@@ -30,3 +30,13 @@ func (*common) Update(_ context.Context, _ string) error {
 func (*common) IsRunning(_ context.Context) bool {
 	return true
 }
+
+// Evacuate prepares the application for a reboot or shutdown.
+func (*common) Evacuate(_ context.Context) error {
+	return nil
+}
+
+// Restore undoes the evacuation after a reboot or shutdown.
+func (*common) Restore(_ context.Context) error {
+	return nil
+}
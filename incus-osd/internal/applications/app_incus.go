@@ -3,6 +3,10 @@ package applications
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
 
 	incusclient "github.com/lxc/incus/v6/client"
 	incusapi "github.com/lxc/incus/v6/shared/api"
@@ -11,6 +15,17 @@ import (
 	"github.com/lxc/incus-os/incus-osd/internal/systemd"
 )
 
+// incusRebootLockKey is the cluster configuration key used to only let one member reboot at a time.
+const incusRebootLockKey = "user.incus-os.reboot-lock"
+
+var (
+	// incusEvacuationTimeout is how long to wait for the reboot lock and the evacuation to complete.
+	incusEvacuationTimeout = 30 * time.Minute
+
+	// incusRebootLockStaleAge is how long before a reboot lock is considered abandoned.
+	incusRebootLockStaleAge = time.Hour
+)
+
 type incus struct{}
 
 // Start starts all the systemd units.
@@ -99,6 +114,168 @@ func (*incus) IsRunning(ctx context.Context) bool {
 	return systemd.IsActive(ctx, "incus.service")
 }
 
+// Evacuate moves the instances away from the cluster member ahead of a reboot or shutdown.
+// The cluster wide reboot lock is held until the member is restored, so only one member
+// goes down at a time.
+func (*incus) Evacuate(ctx context.Context) error {
+	// Nothing to evacuate if Incus isn't running.
+	if !systemd.IsActive(ctx, "incus.service") {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, incusEvacuationTimeout)
+	defer cancel()
+
+	// Connect to Incus.
+	c, err := incusclient.ConnectIncusUnixWithContext(ctx, "", nil)
+	if err != nil {
+		return err
+	}
+
+	// Only cluster members need evacuating.
+	server, _, err := c.GetServer()
+	if err != nil {
+		return err
+	}
+
+	if !server.Environment.ServerClustered {
+		return nil
+	}
+
+	memberName := server.Environment.ServerName
+
+	// Wait for any other member to be done rebooting.
+	err = lockIncusReboot(ctx, c, memberName)
+	if err != nil {
+		return fmt.Errorf("failed to get the cluster reboot lock: %w", err)
+	}
+
+	// Evacuate the member.
+	slog.Info("Evacuating cluster member", "member", memberName)
+
+	op, err := c.UpdateClusterMemberState(memberName, incusapi.ClusterMemberStatePost{Action: "evacuate"})
+	if err == nil {
+		err = op.WaitContext(ctx)
+	}
+
+	if err != nil {
+		_ = unlockIncusReboot(c, memberName)
+
+		return fmt.Errorf("failed to evacuate cluster member %q: %w", memberName, err)
+	}
+
+	return nil
+}
+
+// Restore brings the instances back onto the cluster member, then releases the cluster wide reboot lock.
+func (*incus) Restore(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, incusEvacuationTimeout)
+	defer cancel()
+
+	// Connect to Incus.
+	c, err := incusclient.ConnectIncusUnixWithContext(ctx, "", nil)
+	if err != nil {
+		return err
+	}
+
+	server, _, err := c.GetServer()
+	if err != nil {
+		return err
+	}
+
+	if !server.Environment.ServerClustered {
+		return nil
+	}
+
+	memberName := server.Environment.ServerName
+
+	// Restore the member if still evacuated.
+	member, _, err := c.GetClusterMember(memberName)
+	if err != nil {
+		return err
+	}
+
+	if member.Status == "Evacuated" {
+		slog.Info("Restoring cluster member", "member", memberName)
+
+		op, err := c.UpdateClusterMemberState(memberName, incusapi.ClusterMemberStatePost{Action: "restore"})
+		if err != nil {
+			return fmt.Errorf("failed to restore cluster member %q: %w", memberName, err)
+		}
+
+		err = op.WaitContext(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to restore cluster member %q: %w", memberName, err)
+		}
+	}
+
+	return unlockIncusReboot(c, memberName)
+}
+
+// parseIncusRebootLock returns the holder of the cluster reboot lock and when it was taken.
+func parseIncusRebootLock(value string) (string, time.Time) {
+	holder, since, _ := strings.Cut(value, " ")
+
+	// A lock which can't be parsed is considered stale.
+	sinceTime, _ := time.Parse(time.RFC3339, since)
+
+	return holder, sinceTime
+}
+
+// lockIncusReboot waits for the cluster reboot lock to be free, then takes it.
+func lockIncusReboot(ctx context.Context, c incusclient.InstanceServer, memberName string) error {
+	for {
+		server, etag, err := c.GetServer()
+		if err != nil {
+			return err
+		}
+
+		holder, since := parseIncusRebootLock(server.Config[incusRebootLockKey])
+		if holder == "" || holder == memberName || time.Since(since) > incusRebootLockStaleAge {
+			put := server.Writable()
+			put.Config[incusRebootLockKey] = memberName + " " + time.Now().UTC().Format(time.RFC3339)
+
+			err = c.UpdateServer(put, etag)
+			if err == nil {
+				return nil
+			}
+
+			// Another member changed the configuration at the same time, try again.
+			if !incusapi.StatusErrorCheck(err, http.StatusPreconditionFailed) {
+				return err
+			}
+
+			continue
+		}
+
+		slog.Info("Waiting for another cluster member to complete its reboot", "member", holder)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+// unlockIncusReboot releases the cluster reboot lock if held by the member.
+func unlockIncusReboot(c incusclient.InstanceServer, memberName string) error {
+	server, etag, err := c.GetServer()
+	if err != nil {
+		return err
+	}
+
+	holder, _ := parseIncusRebootLock(server.Config[incusRebootLockKey])
+	if holder != memberName {
+		return nil
+	}
+
+	put := server.Writable()
+	delete(put.Config, incusRebootLockKey)
+
+	return c.UpdateServer(put, etag)
+}
+
 func (*incus) applyDefaults(c incusclient.InstanceServer) error {
 	// Get server configuration.
 	serverConfig, serverConfigEtag, err := c.GetServer()
@@ -0,0 +1,126 @@
+package applications
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	incusclient "github.com/lxc/incus/v6/client"
+	incusapi "github.com/lxc/incus/v6/shared/api"
+	"github.com/stretchr/testify/require"
+)
+
+// testIncusServer fakes the server configuration of an Incus cluster.
+type testIncusServer struct {
+	incusclient.InstanceServer
+
+	config map[string]string
+	etag   int
+
+	// Number of updates to reject as if another member changed the configuration first.
+	conflicts int
+}
+
+func (s *testIncusServer) GetServer() (*incusapi.Server, string, error) {
+	server := &incusapi.Server{}
+	server.Config = maps.Clone(s.config)
+
+	return server, strconv.Itoa(s.etag), nil
+}
+
+func (s *testIncusServer) UpdateServer(server incusapi.ServerPut, etag string) error {
+	if s.conflicts > 0 || etag != strconv.Itoa(s.etag) {
+		s.conflicts--
+
+		return incusapi.StatusErrorf(http.StatusPreconditionFailed, "ETag doesn't match")
+	}
+
+	s.config = maps.Clone(server.Config)
+	s.etag++
+
+	return nil
+}
+
+func TestParseIncusRebootLock(t *testing.T) {
+	t.Parallel()
+
+	holder, since := parseIncusRebootLock("server01 2025-01-01T10:00:00Z")
+	require.Equal(t, "server01", holder)
+	require.Equal(t, time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC), since)
+
+	// No lock.
+	holder, since = parseIncusRebootLock("")
+	require.Empty(t, holder)
+	require.True(t, since.IsZero())
+
+	// Invalid timestamps are considered stale.
+	holder, since = parseIncusRebootLock("server01 yesterday")
+	require.Equal(t, "server01", holder)
+	require.True(t, since.IsZero())
+
+	holder, since = parseIncusRebootLock("server01")
+	require.Equal(t, "server01", holder)
+	require.True(t, since.IsZero())
+}
+
+func TestIncusRebootLock(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := &testIncusServer{config: map[string]string{"core.https_address": ":8443"}}
+
+	// Take the free lock, retrying on concurrent changes.
+	c.conflicts = 1
+
+	err := lockIncusReboot(ctx, c, "server01")
+	require.NoError(t, err)
+
+	holder, since := parseIncusRebootLock(c.config[incusRebootLockKey])
+	require.Equal(t, "server01", holder)
+	require.WithinDuration(t, time.Now(), since, time.Minute)
+	require.Equal(t, ":8443", c.config["core.https_address"])
+
+	// The holder can take it again.
+	err = lockIncusReboot(ctx, c, "server01")
+	require.NoError(t, err)
+
+	// Other members wait for it.
+	waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	err = lockIncusReboot(waitCtx, c, "server02")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Only the holder releases it.
+	err = unlockIncusReboot(c, "server02")
+	require.NoError(t, err)
+
+	holder, _ = parseIncusRebootLock(c.config[incusRebootLockKey])
+	require.Equal(t, "server01", holder)
+
+	err = unlockIncusReboot(c, "server01")
+	require.NoError(t, err)
+	require.NotContains(t, c.config, incusRebootLockKey)
+	require.Equal(t, ":8443", c.config["core.https_address"])
+
+	// Stale locks are taken over.
+	c.config[incusRebootLockKey] = "server01 " + time.Now().Add(-2*incusRebootLockStaleAge).UTC().Format(time.RFC3339)
+
+	err = lockIncusReboot(ctx, c, "server02")
+	require.NoError(t, err)
+
+	holder, _ = parseIncusRebootLock(c.config[incusRebootLockKey])
+	require.Equal(t, "server02", holder)
+
+	// So are unparsable ones.
+	c.config[incusRebootLockKey] = "server01"
+
+	err = lockIncusReboot(ctx, c, "server03")
+	require.NoError(t, err)
+
+	holder, _ = parseIncusRebootLock(c.config[incusRebootLockKey])
+	require.Equal(t, "server03", holder)
+}
@@ -11,4 +11,8 @@ type Application interface {
 	Initialize(ctx context.Context) error
 	Update(ctx context.Context, version string) error
 	IsRunning(ctx context.Context) bool
+
+	// Evacuate is called ahead of a daemon initiated reboot or shutdown, Restore on the following startup.
+	Evacuate(ctx context.Context) error
+	Restore(ctx context.Context) error
 }
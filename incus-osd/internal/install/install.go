@@ -41,6 +41,12 @@ var cdromDevice = "/dev/sr0"
 
 var cdromMappedDevice = "/dev/mapper/sr0"
 
+// GPT partition type GUIDs of the ESP and generic Linux partitions.
+const (
+	efiPartitionType   = "C12A7328-F81F-11D2-BA4B-00A0C93EC93B"
+	linuxPartitionType = "0FC63DAF-8483-4772-8E79-3D69D8477DE4"
+)
+
 // CheckSystemRequirements verifies that the system meets the minimum requirements for running Incus OS.
 func CheckSystemRequirements(ctx context.Context) error {
 	// Check if systemd-repart has failed (we're either running from a read-only or a small USB
@@ -438,11 +444,17 @@ func (i *Install) performInstall(ctx context.Context, modal *tui.Modal, sourceDe
 		numPartitionsToCopy = 5
 	}
 
+	// Get the local architecture, determining the expected partition types.
+	arch, err := systemd.GetArchitecture()
+	if err != nil {
+		return err
+	}
+
 	modal.Update("Cloning GPT partitions.")
 
 	// Copy partition definitions.
 	for idx := 1; idx <= numPartitionsToCopy; idx++ {
-		err := copyPartitionDefinition(ctx, actualSourceDevice, targetDevice, idx)
+		err := copyPartitionDefinition(ctx, actualSourceDevice, targetDevice, idx, arch)
 		if err != nil {
 			return err
 		}
@@ -453,17 +465,17 @@ func (i *Install) performInstall(ctx context.Context, modal *tui.Modal, sourceDe
 	// at first boot time. This is because systemd-repart likes to place the small /usr-verity sig
 	// partition prior to the ESP partition.
 	if numPartitionsToCopy == 5 {
-		_, err = subprocess.RunCommandContext(ctx, "sgdisk", "-n", "6::+16KiB", "-t", "6:8385", "-c", "6:_empty", targetDevice)
+		_, err = subprocess.RunCommandContext(ctx, "sgdisk", "-n", "6::+16KiB", "-t", "6:"+arch.USRVeritySigPartitionType, "-c", "6:_empty", targetDevice)
 		if err != nil {
 			return err
 		}
 
-		_, err = subprocess.RunCommandContext(ctx, "sgdisk", "-n", "7::+100MiB", "-t", "7:8319", "-c", "7:_empty", targetDevice)
+		_, err = subprocess.RunCommandContext(ctx, "sgdisk", "-n", "7::+100MiB", "-t", "7:"+arch.USRVerityPartitionType, "-c", "7:_empty", targetDevice)
 		if err != nil {
 			return err
 		}
 
-		_, err = subprocess.RunCommandContext(ctx, "sgdisk", "-n", "8::+1GiB", "-t", "8:8314", "-c", "8:_empty", targetDevice)
+		_, err = subprocess.RunCommandContext(ctx, "sgdisk", "-n", "8::+1GiB", "-t", "8:"+arch.USRPartitionType, "-c", "8:_empty", targetDevice)
 		if err != nil {
 			return err
 		}
@@ -560,7 +572,7 @@ func (i *Install) performInstall(ctx context.Context, modal *tui.Modal, sourceDe
 // Copy partition definitions to target device. We can't just do a `sgdisk -R target source`
 // because the install media may have a different sector size than the target device (for example,
 // if the installer is running from a CDROM).
-func copyPartitionDefinition(ctx context.Context, src string, tgt string, partitionIndex int) error {
+func copyPartitionDefinition(ctx context.Context, src string, tgt string, partitionIndex int, arch systemd.Architecture) error {
 	// Get source partition information.
 	output, err := subprocess.RunCommandContext(ctx, "sgdisk", "-i", strconv.Itoa(partitionIndex), src)
 	if err != nil {
@@ -572,34 +584,27 @@ func copyPartitionDefinition(ctx context.Context, src string, tgt string, partit
 		return errors.New(output)
 	}
 
-	partitionTypeRegex := regexp.MustCompile(`Partition GUID code: .+ \((.+)\)`)
+	partitionTypeRegex := regexp.MustCompile(`Partition GUID code: (\S+) \((.+)\)`)
 	partitionGUIDRegex := regexp.MustCompile(`Partition unique GUID: (.+)`)
 	partitionNameRegex := regexp.MustCompile(`Partition name: '(.+)'`)
 	partitionSizeRegex := regexp.MustCompile(`Partition size: \d+ sectors \((.+)\)`)
 
-	var partitionHexCode string
-	partitionType := partitionTypeRegex.FindStringSubmatch(output)[1]
+	partitionTypeMatch := partitionTypeRegex.FindStringSubmatch(output)
+	partitionTypeGUID := strings.ToUpper(partitionTypeMatch[1])
+	partitionType := partitionTypeMatch[2]
 	partitionGUID := partitionGUIDRegex.FindStringSubmatch(output)[1]
 	partitionName := partitionNameRegex.FindStringSubmatch(output)[1]
 	partitionSize := strings.ReplaceAll(partitionSizeRegex.FindStringSubmatch(output)[1], " ", "")
 
-	switch partitionType {
-	case "EFI system partition":
-		partitionHexCode = "EF00"
-	case "Linux filesystem":
-		partitionHexCode = "8300"
-	case "Linux x86-64 /usr verity signature":
-		partitionHexCode = "8385"
-	case "Linux x86-64 /usr verity":
-		partitionHexCode = "8319"
-	case "Linux x86-64 /usr":
-		partitionHexCode = "8314"
+	// Only copy the generic partitions and the /usr partitions of the local architecture.
+	switch partitionTypeGUID {
+	case efiPartitionType, linuxPartitionType, arch.USRVeritySigPartitionType, arch.USRVerityPartitionType, arch.USRPartitionType:
 	default:
 		return fmt.Errorf("unrecognized partition type '%s'", partitionType)
 	}
 
 	// Create the partition on the target device.
-	_, err = subprocess.RunCommandContext(ctx, "sgdisk", "-n", strconv.Itoa(partitionIndex)+"::+"+partitionSize, "-u", strconv.Itoa(partitionIndex)+":"+partitionGUID, "-t", strconv.Itoa(partitionIndex)+":"+partitionHexCode, "-c", strconv.Itoa(partitionIndex)+":"+partitionName, tgt)
+	_, err = subprocess.RunCommandContext(ctx, "sgdisk", "-n", strconv.Itoa(partitionIndex)+"::+"+partitionSize, "-u", strconv.Itoa(partitionIndex)+":"+partitionGUID, "-t", strconv.Itoa(partitionIndex)+":"+partitionTypeGUID, "-c", strconv.Itoa(partitionIndex)+":"+partitionName, tgt)
 
 	return err
 }
@@ -0,0 +1,98 @@
+package maintenance
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lxc/incus/v6/shared/units"
+
+	"github.com/lxc/incus-os/incus-osd/api"
+)
+
+// ErrInvalidBandwidthLimit is returned when a download rate limit can't be parsed.
+var ErrInvalidBandwidthLimit = errors.New("invalid bandwidth limit")
+
+// ValidateBandwidth checks that the timezone, limits and windows can be parsed.
+func ValidateBandwidth(config api.SystemUpdateBandwidth) error {
+	_, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return fmt.Errorf("%w: bad timezone %q: %w", ErrInvalidBandwidthLimit, config.Timezone, err)
+	}
+
+	_, err = parseLimit(config.Limit)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range config.Windows {
+		_, err = parseLimit(w.Limit)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = parseWindows(bandwidthWindows(config))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// BandwidthLimit returns the download rate limit in bytes per second applying at the provided time,
+// zero meaning unlimited. The first window containing that time overrides the default limit.
+func BandwidthLimit(config api.SystemUpdateBandwidth, now time.Time) (int64, error) {
+	windows, err := parseWindows(bandwidthWindows(config))
+	if err != nil {
+		return 0, err
+	}
+
+	loc, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad timezone %q: %w", ErrInvalidBandwidthLimit, config.Timezone, err)
+	}
+
+	// Check the window occurrences starting yesterday (to catch windows wrapping past midnight) and today.
+	localNow := now.In(loc)
+	today := time.Date(localNow.Year(), localNow.Month(), localNow.Day(), 0, 0, 0, 0, loc)
+
+	for i, w := range windows {
+		for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+			start, end, ok := w.occurrence(day)
+			if ok && !localNow.Before(start) && localNow.Before(end) {
+				return parseLimit(config.Windows[i].Limit)
+			}
+		}
+	}
+
+	return parseLimit(config.Limit)
+}
+
+// bandwidthWindows returns the time ranges of the bandwidth windows.
+func bandwidthWindows(config api.SystemUpdateBandwidth) []api.SystemUpdateMaintenanceWindow {
+	windows := make([]api.SystemUpdateMaintenanceWindow, 0, len(config.Windows))
+	for _, w := range config.Windows {
+		windows = append(windows, api.SystemUpdateMaintenanceWindow{Days: w.Days, Start: w.Start, End: w.End})
+	}
+
+	return windows
+}
+
+// parseLimit parses a rate limit (for example "50Mbit") into bytes per second.
+func parseLimit(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	bits, err := units.ParseBitSizeString(value)
+	if err != nil || bits < 0 {
+		return 0, fmt.Errorf("%w: bad limit %q", ErrInvalidBandwidthLimit, value)
+	}
+
+	if bits == 0 {
+		return 0, nil
+	}
+
+	return max(bits/8, 1), nil
+}
@@ -0,0 +1,52 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lxc/incus-os/incus-osd/api"
+)
+
+func TestBandwidthLimit(t *testing.T) {
+	t.Parallel()
+
+	config := api.SystemUpdateBandwidth{
+		Timezone: "America/New_York",
+		Limit:    "80Mbit",
+		Windows: []api.SystemUpdateBandwidthWindow{
+			{Days: []string{"monday", "tuesday", "wednesday", "thursday", "friday"}, Start: "08:00", End: "18:00", Limit: "8Mbit"},
+			{Start: "22:00", End: "06:00", Limit: "0"},
+		},
+	}
+
+	require.NoError(t, ValidateBandwidth(config))
+
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	tests := []struct {
+		now   time.Time
+		limit int64
+	}{
+		// Business hours.
+		{time.Date(2025, 1, 1, 12, 0, 0, 0, loc), 1000000},
+		// Evening.
+		{time.Date(2025, 1, 1, 19, 0, 0, 0, loc), 10000000},
+		// Overnight, past midnight.
+		{time.Date(2025, 1, 2, 3, 0, 0, 0, loc), 0},
+		// Weekend.
+		{time.Date(2025, 1, 4, 12, 0, 0, 0, loc), 10000000},
+	}
+
+	for _, test := range tests {
+		limit, err := BandwidthLimit(config, test.now)
+		require.NoError(t, err)
+		require.Equal(t, test.limit, limit, test.now.String())
+	}
+
+	// Invalid limits are rejected.
+	config.Windows[0].Limit = "fast"
+	require.ErrorIs(t, ValidateBandwidth(config), ErrInvalidBandwidthLimit)
+}
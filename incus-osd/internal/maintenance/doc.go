@@ -0,0 +1,2 @@
+// Package maintenance implements the maintenance windows restricting when updates get applied.
+package maintenance
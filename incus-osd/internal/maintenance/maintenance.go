@@ -0,0 +1,198 @@
+package maintenance
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lxc/incus-os/incus-osd/api"
+)
+
+// Action is an update step which can be restricted to maintenance windows.
+type Action string
+
+const (
+	// ActionDownload is the download (and staging) of OS and application updates.
+	ActionDownload Action = "download"
+
+	// ActionApplyApplications is the installation and restart of updated applications.
+	ActionApplyApplications Action = "apply_applications"
+
+	// ActionReboot is the reboot into a staged OS update.
+	ActionReboot Action = "reboot"
+)
+
+// ErrInvalidMaintenanceWindow is returned when a maintenance window can't be parsed.
+var ErrInvalidMaintenanceWindow = errors.New("invalid maintenance window")
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// window is a parsed maintenance window.
+type window struct {
+	days  []time.Weekday
+	start int // Minutes since midnight.
+	end   int
+}
+
+// ValidateMaintenance checks that the timezone and all the windows can be parsed.
+func ValidateMaintenance(config api.SystemUpdateMaintenance) error {
+	_, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return fmt.Errorf("%w: bad timezone %q: %w", ErrInvalidMaintenanceWindow, config.Timezone, err)
+	}
+
+	for _, action := range []Action{ActionDownload, ActionApplyApplications, ActionReboot} {
+		_, err := parseWindows(windowsFor(config, action))
+		if err != nil {
+			return fmt.Errorf("%s: %w", action, err)
+		}
+	}
+
+	return nil
+}
+
+// IsAllowed returns whether the action may be performed at the provided time.
+func IsAllowed(config api.SystemUpdateMaintenance, action Action, now time.Time) (bool, error) {
+	next, err := NextWindow(config, action, now)
+	if err != nil {
+		return false, err
+	}
+
+	return !next.After(now), nil
+}
+
+// NextWindow returns when the action may next be performed, now if it's currently allowed.
+func NextWindow(config api.SystemUpdateMaintenance, action Action, now time.Time) (time.Time, error) {
+	// Check if the windows are overridden.
+	if config.OverrideUntil != nil && now.Before(*config.OverrideUntil) {
+		return now, nil
+	}
+
+	windows, err := parseWindows(windowsFor(config, action))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// Without any window, the action is always allowed.
+	if len(windows) == 0 {
+		return now, nil
+	}
+
+	loc, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: bad timezone %q: %w", ErrInvalidMaintenanceWindow, config.Timezone, err)
+	}
+
+	// Go through every window occurrence starting from yesterday (to catch windows wrapping past
+	// midnight) until a week from now.
+	localNow := now.In(loc)
+	today := time.Date(localNow.Year(), localNow.Month(), localNow.Day(), 0, 0, 0, 0, loc)
+
+	var next time.Time
+
+	for i := -1; i <= 7; i++ {
+		day := today.AddDate(0, 0, i)
+
+		for _, w := range windows {
+			start, end, ok := w.occurrence(day)
+			if !ok {
+				continue
+			}
+
+			// Currently in the window.
+			if !localNow.Before(start) && localNow.Before(end) {
+				return now, nil
+			}
+
+			if start.After(localNow) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+	}
+
+	return next, nil
+}
+
+// occurrence returns the start and end of the window on the provided day, if it occurs on that day.
+func (w window) occurrence(day time.Time) (time.Time, time.Time, bool) {
+	if len(w.days) > 0 && !slices.Contains(w.days, day.Weekday()) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, w.start, 0, 0, day.Location())
+
+	end := time.Date(day.Year(), day.Month(), day.Day(), 0, w.end, 0, 0, day.Location())
+	if w.end <= w.start {
+		end = end.AddDate(0, 0, 1)
+	}
+
+	return start, end, true
+}
+
+// windowsFor returns the windows applying to an action.
+func windowsFor(config api.SystemUpdateMaintenance, action Action) []api.SystemUpdateMaintenanceWindow {
+	switch action {
+	case ActionDownload:
+		return config.Download
+	case ActionApplyApplications:
+		return config.ApplyApplications
+	case ActionReboot:
+		return config.Reboot
+	}
+
+	return nil
+}
+
+// parseWindows parses a list of maintenance windows.
+func parseWindows(windows []api.SystemUpdateMaintenanceWindow) ([]window, error) {
+	ret := make([]window, 0, len(windows))
+
+	for _, w := range windows {
+		parsed := window{}
+
+		for _, day := range w.Days {
+			weekday, ok := weekdays[strings.ToLower(day)]
+			if !ok {
+				return nil, fmt.Errorf("%w: bad day %q", ErrInvalidMaintenanceWindow, day)
+			}
+
+			parsed.days = append(parsed.days, weekday)
+		}
+
+		var err error
+
+		parsed.start, err = parseTimeOfDay(w.Start)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed.end, err = parseTimeOfDay(w.End)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, parsed)
+	}
+
+	return ret, nil
+}
+
+// parseTimeOfDay parses a HH:MM time into minutes since midnight.
+func parseTimeOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad time %q", ErrInvalidMaintenanceWindow, value)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,74 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lxc/incus-os/incus-osd/api"
+)
+
+func TestNextWindow(t *testing.T) {
+	t.Parallel()
+
+	config := api.SystemUpdateMaintenance{
+		Timezone: "America/New_York",
+		Reboot: []api.SystemUpdateMaintenanceWindow{
+			{Days: []string{"Saturday"}, Start: "22:00", End: "02:00"},
+		},
+	}
+
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	tests := []struct {
+		now  time.Time
+		next time.Time
+	}{
+		// Before the window.
+		{time.Date(2025, 1, 1, 12, 0, 0, 0, loc), time.Date(2025, 1, 4, 22, 0, 0, 0, loc)},
+		// In the window.
+		{time.Date(2025, 1, 4, 23, 0, 0, 0, loc), time.Date(2025, 1, 4, 23, 0, 0, 0, loc)},
+		// In the window, past midnight.
+		{time.Date(2025, 1, 5, 1, 0, 0, 0, loc), time.Date(2025, 1, 5, 1, 0, 0, 0, loc)},
+		// Right after the window.
+		{time.Date(2025, 1, 5, 2, 0, 0, 0, loc), time.Date(2025, 1, 11, 22, 0, 0, 0, loc)},
+	}
+
+	for _, test := range tests {
+		next, err := NextWindow(config, ActionReboot, test.now.UTC())
+		require.NoError(t, err)
+		require.True(t, test.next.Equal(next), "now %s: expected %s, got %s", test.now, test.next, next)
+	}
+
+	// Actions without windows are always allowed.
+	allowed, err := IsAllowed(config, ActionDownload, time.Date(2025, 1, 1, 12, 0, 0, 0, loc))
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	// Overrides open all windows.
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, loc)
+	until := now.Add(time.Hour)
+	config.OverrideUntil = &until
+
+	allowed, err = IsAllowed(config, ActionReboot, now)
+	require.NoError(t, err)
+	require.True(t, allowed)
+}
+
+func TestValidateMaintenance(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, ValidateMaintenance(api.SystemUpdateMaintenance{
+		Download: []api.SystemUpdateMaintenanceWindow{{Start: "00:00", End: "00:00"}},
+	}))
+
+	for _, config := range []api.SystemUpdateMaintenance{
+		{Timezone: "Nowhere/Special"},
+		{Download: []api.SystemUpdateMaintenanceWindow{{Start: "25:00", End: "01:00"}}},
+		{Reboot: []api.SystemUpdateMaintenanceWindow{{Days: []string{"someday"}, Start: "01:00", End: "02:00"}}},
+	} {
+		require.ErrorIs(t, ValidateMaintenance(config), ErrInvalidMaintenanceWindow)
+	}
+}
@@ -0,0 +1,90 @@
+package providers
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/lxc/incus-os/incus-osd/internal/systemd"
+)
+
+// localArchitecture returns the systemd name of the architecture release files are selected for.
+var localArchitecture = func() (string, error) {
+	arch, err := systemd.GetArchitecture()
+	if err != nil {
+		return "", err
+	}
+
+	return arch.Name, nil
+}
+
+// assetArchitecture returns the architecture a release file is built for, or an empty string for files
+// not specific to one. The OS partition images carry it in their partition type ("IncusOS_<version>.usr-arm64.<uuid>.raw"),
+// other files may be qualified with an extra extension ("IncusOS_<version>.arm64.efi" or "incus.arm64.raw.gz").
+func assetArchitecture(name string) string {
+	fields := strings.Split(strings.TrimSuffix(name, ".gz"), ".")
+
+	for _, field := range fields[1:] {
+		partition := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(field, "usr-"), "-sig"), "-verity")
+
+		if slices.Contains(systemd.ArchitectureNames(), partition) {
+			return partition
+		}
+	}
+
+	return ""
+}
+
+// localAssetName returns the name of a release file once downloaded, dropping its compression
+// and architecture qualifier ("IncusOS_<version>.arm64.efi.gz" is stored as "IncusOS_<version>.efi").
+func localAssetName(name string) string {
+	fields := strings.Split(strings.TrimSuffix(name, ".gz"), ".")
+
+	kept := slices.DeleteFunc(fields[1:], func(field string) bool {
+		return slices.Contains(systemd.ArchitectureNames(), field)
+	})
+
+	return strings.Join(append([]string{fields[0]}, kept...), ".")
+}
+
+// archAssetFilter returns a filter selecting the release files (names, paths or URLs) for the local architecture out of
+// the provided ones. Files built for another architecture are skipped, as are unqualified files for which a qualified
+// variant exists.
+func archAssetFilter(names []string) (func(name string) bool, error) {
+	arch, err := localArchitecture()
+	if err != nil {
+		return nil, err
+	}
+
+	qualified := map[string]bool{}
+	for _, name := range names {
+		name = filepath.Base(name)
+
+		if assetArchitecture(name) == arch && localAssetName(name) != strings.TrimSuffix(name, ".gz") {
+			qualified[localAssetName(name)] = true
+		}
+	}
+
+	return func(name string) bool {
+		name = filepath.Base(name)
+
+		nameArch := assetArchitecture(name)
+		if nameArch != "" {
+			return nameArch == arch
+		}
+
+		return !qualified[localAssetName(name)]
+	}, nil
+}
+
+// filterArchAssets returns the release files for the local architecture out of the provided ones.
+func filterArchAssets(names []string) ([]string, error) {
+	keep, err := archAssetFilter(names)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(slices.Clone(names), func(name string) bool {
+		return !keep(name)
+	}), nil
+}
@@ -0,0 +1,126 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// setTestArchitecture selects the release files for the provided architecture.
+func setTestArchitecture(arch string) {
+	localArchitecture = func() (string, error) {
+		return arch, nil
+	}
+}
+
+func TestMain(m *testing.M) {
+	// Select the release files for the same architecture on every test system.
+	setTestArchitecture("x86-64")
+
+	os.Exit(m.Run())
+}
+
+func TestAssetArchitecture(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		arch      string
+		localName string
+	}{
+		{"IncusOS_202501010000.efi", "", "IncusOS_202501010000.efi"},
+		{"IncusOS_202501010000.arm64.efi.gz", "arm64", "IncusOS_202501010000.efi"},
+		{"IncusOS_202501010000.usr-x86-64.abcdef.raw.gz", "x86-64", "IncusOS_202501010000.usr-x86-64.abcdef.raw"},
+		{"IncusOS_202501010000.usr-arm64-verity.abcdef.raw", "arm64", "IncusOS_202501010000.usr-arm64-verity.abcdef.raw"},
+		{"IncusOS_202501010000.usr-arm64-verity-sig.abcdef.raw", "arm64", "IncusOS_202501010000.usr-arm64-verity-sig.abcdef.raw"},
+		{"incus.raw.gz", "", "incus.raw"},
+		{"incus.x86-64.raw.gz", "x86-64", "incus.raw"},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.arch, assetArchitecture(tt.name), tt.name)
+		require.Equal(t, tt.localName, localAssetName(tt.name), tt.name)
+	}
+}
+
+func TestFilterArchAssets(t *testing.T) { //nolint:paralleltest
+	setTestArchitecture("arm64")
+	t.Cleanup(func() { setTestArchitecture("x86-64") })
+
+	assets, err := filterArchAssets([]string{
+		"https://example.com/SHA256SUMS",
+		"https://example.com/IncusOS_202501010000.efi.gz",
+		"https://example.com/IncusOS_202501010000.arm64.efi.gz",
+		"https://example.com/IncusOS_202501010000.usr-x86-64.abcdef.raw.gz",
+		"https://example.com/IncusOS_202501010000.usr-arm64.abcdef.raw.gz",
+		"https://example.com/incus.raw.gz",
+		"https://example.com/debug.x86-64.raw.gz",
+		"https://example.com/debug.raw.gz",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"https://example.com/SHA256SUMS",
+		"https://example.com/IncusOS_202501010000.arm64.efi.gz",
+		"https://example.com/IncusOS_202501010000.usr-arm64.abcdef.raw.gz",
+		"https://example.com/incus.raw.gz",
+		"https://example.com/debug.raw.gz",
+	}, assets)
+}
+
+func TestMirrorArchitecture(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	StagingPath = filepath.Join(tmpDir, "staging")
+
+	setTestArchitecture("arm64")
+	t.Cleanup(func() { setTestArchitecture("x86-64") })
+
+	// A release carrying both architectures.
+	files := map[string][]byte{
+		"IncusOS_202501010000.efi":                   []byte("efi x86-64"),
+		"IncusOS_202501010000.arm64.efi":             []byte("efi arm64"),
+		"IncusOS_202501010000.usr-x86-64.abcdef.raw": []byte("usr x86-64"),
+		"IncusOS_202501010000.usr-arm64.123456.raw":  []byte("usr arm64"),
+		"incus.x86-64.raw":                           []byte("incus x86-64"),
+		"incus.arm64.raw":                            []byte("incus arm64"),
+	}
+
+	srv := newMirrorTestServer(t, "202501010000", files)
+
+	p, err := Load(ctx, nil, "mirror", map[string]string{"url": srv.URL})
+	require.NoError(t, err)
+
+	// Only the arm64 files get downloaded, under their usual names.
+	update, err := p.GetOSUpdate(ctx, "IncusOS", "")
+	require.NoError(t, err)
+
+	updatesPath := filepath.Join(tmpDir, "updates")
+	err = update.Download(ctx, "IncusOS", updatesPath, func(Progress) {})
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(updatesPath)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	data, err := os.ReadFile(filepath.Join(updatesPath, "IncusOS_202501010000.efi"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("efi arm64"), data)
+
+	data, err = os.ReadFile(filepath.Join(updatesPath, "IncusOS_202501010000.usr-arm64.123456.raw"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("usr arm64"), data)
+
+	app, err := p.GetApplication(ctx, "incus", "")
+	require.NoError(t, err)
+
+	appPath := filepath.Join(tmpDir, "apps")
+	err = app.Download(ctx, appPath, func(Progress) {})
+	require.NoError(t, err)
+
+	data, err = os.ReadFile(filepath.Join(appPath, "incus.raw"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("incus arm64"), data)
+}
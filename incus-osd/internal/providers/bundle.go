@@ -0,0 +1,575 @@
+package providers
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// BundlePath is where an uploaded update bundle is kept until it's been applied.
+var BundlePath = "/var/lib/incus-os/bundle/"
+
+// stagedBundle serializes changes to the uploaded update bundle against it being read or applied.
+var stagedBundle struct {
+	mu sync.Mutex
+
+	// Incremented whenever a new bundle is staged.
+	generation int
+
+	// Set while the staged bundle is being applied.
+	applying bool
+}
+
+// bundleSource gives access to the root directory of an update bundle for the duration of a function.
+type bundleSource interface {
+	withBundle(ctx context.Context, f func(root string) error) error
+}
+
+// readBundle validates the content of an update bundle against its signed manifest and
+// returns the release version, the list of files and the manifest.
+func readBundle(root string) (string, []string, manifest, error) {
+	// Deal with a missing bundle.
+	_, err := os.Lstat(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil, nil, ErrNoUpdateAvailable
+		}
+
+		return "", nil, nil, err
+	}
+
+	// Get the signed release manifest.
+	manifestBody, err := os.ReadFile(filepath.Join(root, manifestName)) //nolint:gosec
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	manifestSignature, err := os.ReadFile(filepath.Join(root, manifestSignatureName)) //nolint:gosec
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	releaseManifest, err := parseManifest(manifestBody, manifestSignature)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	// Build asset list, making sure every file of the bundle is covered by the manifest.
+	// The manifest of a release may list more files than the bundle needs to hold.
+	assets := []string{}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	for _, entry := range entries {
+		if slices.Contains([]string{manifestName, manifestSignatureName, "RELEASE"}, entry.Name()) {
+			continue
+		}
+
+		_, err := releaseManifest.checksum(entry.Name())
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+		}
+
+		assets = append(assets, entry.Name())
+	}
+
+	if len(assets) == 0 {
+		return "", nil, nil, fmt.Errorf("%w: no release files", ErrInvalidBundle)
+	}
+
+	// Get the release version.
+	version, err := bundleVersion(root, assets, releaseManifest)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	return version, assets, releaseManifest, nil
+}
+
+// bundleVersion returns the release version of a bundle, read from its RELEASE file when
+// present or otherwise from the names of its OS files ("IncusOS_<version>.efi.gz").
+func bundleVersion(root string, assets []string, m manifest) (string, error) {
+	// The RELEASE file must be covered by the manifest.
+	body, err := os.ReadFile(filepath.Join(root, "RELEASE")) //nolint:gosec
+	if err == nil {
+		hash := sha256.Sum256(body)
+
+		err = m.verify("RELEASE", hash[:])
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimSpace(string(body)), nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	// Otherwise all the OS files must agree on the version.
+	version := ""
+
+	for _, asset := range assets {
+		_, suffix, ok := strings.Cut(asset, "_")
+		if !ok {
+			continue
+		}
+
+		assetVersion, _, ok := strings.Cut(suffix, ".")
+		if !ok {
+			continue
+		}
+
+		_, err := ParseVersion(assetVersion)
+		if err != nil {
+			continue
+		}
+
+		if version != "" && version != assetVersion {
+			return "", fmt.Errorf("%w: files for both %q and %q", ErrInvalidBundle, version, assetVersion)
+		}
+
+		version = assetVersion
+	}
+
+	if version == "" {
+		return "", fmt.Errorf("%w: missing RELEASE", ErrInvalidBundle)
+	}
+
+	return version, nil
+}
+
+// ImportBundle extracts an update bundle tarball (optionally gzip compressed), fully validates
+// it and stages it for the bundle provider, returning the release version.
+func ImportBundle(ctx context.Context, r io.Reader) (string, error) {
+	// Don't bother with the upload if the current bundle can't be replaced.
+	stagedBundle.mu.Lock()
+	applying := stagedBundle.applying
+	stagedBundle.mu.Unlock()
+
+	if applying {
+		return "", ErrBundleInUse
+	}
+
+	// Handle compressed tarballs.
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(2)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+
+	var src io.Reader = br
+
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+		}
+
+		defer gz.Close()
+
+		src = gz
+	}
+
+	// Extract into a temporary directory next to the final one.
+	err = os.MkdirAll(filepath.Dir(filepath.Clean(BundlePath)), 0o700)
+	if err != nil {
+		return "", err
+	}
+
+	tmpPath, err := os.MkdirTemp(filepath.Dir(filepath.Clean(BundlePath)), "bundle.")
+	if err != nil {
+		return "", err
+	}
+
+	defer func() { _ = os.RemoveAll(tmpPath) }()
+
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return "", fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+		}
+
+		// Only flat regular files are expected.
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if hdr.Typeflag != tar.TypeReg || name != filepath.Base(name) || name == ".." {
+			return "", fmt.Errorf("%w: unexpected entry %q", ErrInvalidBundle, hdr.Name)
+		}
+
+		err = extractBundleFile(ctx, tr, filepath.Join(tmpPath, name))
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, fs.ErrExist) {
+				return "", fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+			}
+
+			return "", err
+		}
+	}
+
+	// Validate the bundle.
+	version, assets, m, err := readBundle(tmpPath)
+	if err != nil {
+		if errors.Is(err, ErrInvalidBundle) {
+			return "", err
+		}
+
+		return "", fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+
+	for _, asset := range assets {
+		err = verifyStaged(filepath.Join(tmpPath, asset), asset, m)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+		}
+	}
+
+	// Replace any previous bundle, unless it's being applied.
+	stagedBundle.mu.Lock()
+	defer stagedBundle.mu.Unlock()
+
+	if stagedBundle.applying {
+		return "", ErrBundleInUse
+	}
+
+	err = os.RemoveAll(BundlePath)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Rename(tmpPath, filepath.Clean(BundlePath))
+	if err != nil {
+		return "", err
+	}
+
+	stagedBundle.generation++
+
+	return version, nil
+}
+
+// RemoveBundle deletes the staged update bundle.
+func RemoveBundle(_ context.Context) error {
+	stagedBundle.mu.Lock()
+	defer stagedBundle.mu.Unlock()
+
+	if stagedBundle.applying {
+		return ErrBundleInUse
+	}
+
+	return os.RemoveAll(BundlePath)
+}
+
+// AcquireBundle marks the staged update bundle as being applied, rejecting uploads until the returned
+// function is called. That function then removes the bundle, unless it got replaced in the meantime.
+func AcquireBundle(_ context.Context) (func() error, error) {
+	stagedBundle.mu.Lock()
+	defer stagedBundle.mu.Unlock()
+
+	if stagedBundle.applying {
+		return nil, ErrBundleInUse
+	}
+
+	stagedBundle.applying = true
+	generation := stagedBundle.generation
+
+	return func() error {
+		stagedBundle.mu.Lock()
+		defer stagedBundle.mu.Unlock()
+
+		stagedBundle.applying = false
+
+		if stagedBundle.generation != generation {
+			return nil
+		}
+
+		return os.RemoveAll(BundlePath)
+	}, nil
+}
+
+// extractBundleFile writes a single file out of the bundle tarball.
+func extractBundleFile(ctx context.Context, r io.Reader, target string) error {
+	// #nosec G304
+	fd, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	defer fd.Close()
+
+	// Copy in chunks, checking for cancellation in between.
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		_, err := io.CopyN(fd, r, 4*1024*1024)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return err
+		}
+	}
+
+	return fd.Close()
+}
+
+// copyBundleAsset copies, validates and (if needed) decompresses a file from a bundle into place.
+func copyBundleAsset(ctx context.Context, root string, name string, m manifest, target string, progressFunc func(Progress)) error {
+	return fetchAsset(ctx, fileAssetSource(filepath.Join(root, name)), name, m, filepath.Join(target, localAssetName(name)), strings.HasSuffix(name, ".gz"), progressFunc)
+}
+
+// bundleAssetsSize returns the combined size of the provided bundle files.
+func bundleAssetsSize(ctx context.Context, source bundleSource, names []string) (int64, error) {
+	total := int64(0)
+
+	err := source.withBundle(ctx, func(root string) error {
+		for _, name := range names {
+			size, err := fileAssetSize(filepath.Join(root, name))
+			if err != nil {
+				return err
+			}
+
+			total += size
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// An application from an update bundle.
+type bundleApplication struct {
+	source bundleSource
+
+	assets   []string
+	manifest manifest
+	name     string
+	version  string
+}
+
+func (a *bundleApplication) Name() string {
+	return a.name
+}
+
+func (a *bundleApplication) Version() string {
+	return a.version
+}
+
+func (a *bundleApplication) IsNewerThan(otherVersion string) (bool, error) {
+	return isNewerVersion(a.version, otherVersion)
+}
+
+func (a *bundleApplication) Download(ctx context.Context, target string, progressFunc func(Progress)) error {
+	// Create the target path.
+	err := os.MkdirAll(target, 0o700)
+	if err != nil {
+		return err
+	}
+
+	return a.source.withBundle(ctx, func(root string) error {
+		for _, asset := range a.selectAssets() {
+			// Copy the application.
+			err := copyBundleAsset(ctx, root, asset, a.manifest, target, progressFunc)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (a *bundleApplication) DownloadSize(ctx context.Context) (int64, error) {
+	return bundleAssetsSize(ctx, a.source, a.selectAssets())
+}
+
+// selectAssets returns the bundle files making up the application.
+func (a *bundleApplication) selectAssets() []string {
+	assets := []string{}
+
+	for _, asset := range a.assets {
+		appName := strings.TrimSuffix(localAssetName(asset), ".raw")
+
+		// Only select the desired applications.
+		if appName != a.name {
+			continue
+		}
+
+		assets = append(assets, asset)
+	}
+
+	return assets
+}
+
+// An OS update from an update bundle.
+type bundleOSUpdate struct {
+	source bundleSource
+
+	assets   []string
+	manifest manifest
+	version  string
+}
+
+func (o *bundleOSUpdate) Version() string {
+	return o.version
+}
+
+func (o *bundleOSUpdate) IsNewerThan(otherVersion string) (bool, error) {
+	return isNewerVersion(o.version, otherVersion)
+}
+
+func (o *bundleOSUpdate) Download(ctx context.Context, osName string, target string, progressFunc func(Progress)) error {
+	// Clear the path.
+	err := os.RemoveAll(target)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Create the target path.
+	err = os.MkdirAll(target, 0o700)
+	if err != nil {
+		return err
+	}
+
+	return o.source.withBundle(ctx, func(root string) error {
+		for _, asset := range o.selectAssets(osName) {
+			// Copy the actual update.
+			err := copyBundleAsset(ctx, root, asset, o.manifest, target, progressFunc)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (o *bundleOSUpdate) DownloadSize(ctx context.Context, osName string) (int64, error) {
+	return bundleAssetsSize(ctx, o.source, o.selectAssets(osName))
+}
+
+// selectAssets returns the bundle files making up the OS update.
+func (o *bundleOSUpdate) selectAssets(osName string) []string {
+	assets := []string{}
+
+	for _, asset := range o.assets {
+		// Only select OS files for the expected version.
+		if !strings.HasPrefix(asset, osName+"_"+o.version) {
+			continue
+		}
+
+		// Parse the file names.
+		fields := strings.SplitN(localAssetName(asset), ".", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		// Skip the full image.
+		if fields[1] == "img" || fields[1] == "iso" {
+			continue
+		}
+
+		assets = append(assets, asset)
+	}
+
+	return assets
+}
+
+// getBundleOSUpdate returns the OS update held by a validated bundle, if any.
+func getBundleOSUpdate(source bundleSource, osName string, version string, assets []string, m manifest) (OSUpdate, error) {
+	// Only consider the files for the local architecture.
+	assets, err := filterArchAssets(assets)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the list of assets for the OS update contains at least one file
+	// for the release version, otherwise we shouldn't report an OS update.
+	foundUpdateFile := false
+	for _, asset := range assets {
+		if strings.HasPrefix(asset, osName+"_") && strings.Contains(asset, version) {
+			foundUpdateFile = true
+
+			break
+		}
+	}
+
+	if !foundUpdateFile {
+		return nil, ErrNoUpdateAvailable
+	}
+
+	update := &bundleOSUpdate{
+		source:   source,
+		assets:   assets,
+		manifest: m,
+		version:  version,
+	}
+
+	// Make sure none of the OS files listed in the manifest is missing from the bundle.
+	names, err := filterArchAssets(slices.Collect(maps.Keys(m)))
+	if err != nil {
+		return nil, err
+	}
+
+	expected := &bundleOSUpdate{assets: names, version: version}
+	for _, name := range expected.selectAssets(osName) {
+		if !slices.Contains(assets, name) {
+			return nil, fmt.Errorf("%w: missing %q", ErrInvalidBundle, name)
+		}
+	}
+
+	return update, nil
+}
+
+// getBundleApplication returns the application held by a validated bundle, if any.
+func getBundleApplication(source bundleSource, name string, version string, assets []string, m manifest) (Application, error) {
+	// Only consider the files for the local architecture.
+	assets, err := filterArchAssets(assets)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the list of assets contains a "<name>.raw" or "<name>.raw.gz" file,
+	// otherwise we shouldn't return an application update.
+	if !slices.ContainsFunc(assets, func(asset string) bool { return localAssetName(asset) == name+".raw" }) {
+		return nil, ErrNoUpdateAvailable
+	}
+
+	return &bundleApplication{
+		source:   source,
+		name:     name,
+		assets:   assets,
+		manifest: m,
+		version:  version,
+	}, nil
+}
@@ -0,0 +1,51 @@
+package providers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/lxc/incus/v6/shared/proxy"
+
+	"github.com/lxc/incus-os/incus-osd/internal/state"
+)
+
+// newHTTPTransport returns an HTTP transport using the system's proxy configuration
+// and trusting the optional PEM encoded CA certificate on top of the system ones.
+func newHTTPTransport(s *state.State, caCertificate string) (*http.Transport, error) {
+	// Setup the TLS configuration.
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caCertificate != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM([]byte(caCertificate)) {
+			return nil, errors.New("invalid CA certificate")
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	// Apply the system's current proxy configuration to each request.
+	proxyFunc := func(req *http.Request) (*url.URL, error) {
+		if s == nil || s.System.Network.Config == nil || s.System.Network.Config.Proxy == nil {
+			return proxy.FromEnvironment(req)
+		}
+
+		cfg := s.System.Network.Config.Proxy
+
+		return proxy.FromConfig(cfg.HTTPSProxy, cfg.HTTPProxy, cfg.NoProxy)(req)
+	}
+
+	return &http.Transport{
+		Proxy:           proxyFunc,
+		TLSClientConfig: tlsConfig,
+	}, nil
+}
@@ -0,0 +1,194 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lxc/incus/v6/shared/subprocess"
+
+	"github.com/lxc/incus-os/incus-osd/internal/state"
+	"github.com/lxc/incus-os/incus-osd/internal/systemd"
+)
+
+// runningUSRPath is the dm-verity device of the running /usr image, whose reads are always verified.
+var runningUSRPath = "/dev/mapper/usr"
+
+// deltaSource returns the source of a delta asset, or ErrDeltaUnavailable if the provider doesn't publish it.
+type deltaSource func(ctx context.Context, name string) (assetSource, error)
+
+// httpDeltaSource returns a deltaSource looking up deltas among the provided release file URLs.
+func httpDeltaSource(client *http.Client, assetURLs []string) deltaSource {
+	return func(_ context.Context, name string) (assetSource, error) {
+		for _, assetURL := range assetURLs {
+			if filepath.Base(assetURL) == name {
+				return httpAssetSource(client, assetURL), nil
+			}
+		}
+
+		return nil, ErrDeltaUnavailable
+	}
+}
+
+// deltaAssetName returns the name of the delta reconstructing an (uncompressed) OS update file from
+// the same file of the provided release. Deltas are zstd patches generated with "--patch-from".
+func deltaAssetName(name string, fromVersion string) string {
+	return name + ".delta-" + fromVersion + ".zst"
+}
+
+// isDeltaAsset checks whether a release file is a delta rather than a full OS update file.
+func isDeltaAsset(name string) bool {
+	return strings.Contains(name, ".delta-")
+}
+
+// deltaUpdatesEnabled checks whether the provider is configured to try delta OS updates.
+func deltaUpdatesEnabled(config map[string]string) bool {
+	enabled, _ := strconv.ParseBool(config["delta_updates"])
+
+	return enabled
+}
+
+// fetchOSAsset downloads an OS update file into its target path. When delta updates are enabled, the file is
+// first reconstructed from a delta against the running release, falling back to the full download on failure.
+func fetchOSAsset(ctx context.Context, s *state.State, config map[string]string, name string, m manifest, target string, getDelta deltaSource, src assetSource, progressFunc func(Progress)) error {
+	if deltaUpdatesEnabled(config) {
+		err := fetchDelta(ctx, s, name, m, target, getDelta, progressFunc)
+		if err == nil {
+			return nil
+		}
+
+		if !errors.Is(err, ErrDeltaUnavailable) {
+			slog.WarnContext(ctx, "Failed to apply update delta, falling back to full download", "file", name, "err", err)
+		}
+	}
+
+	return fetchAsset(ctx, src, name, m, target, strings.HasSuffix(name, ".gz"), progressFunc)
+}
+
+// fetchDelta reconstructs an OS update file from a delta against the /usr image of the running release,
+// verifying the result against the release manifest before moving it into place.
+func fetchDelta(ctx context.Context, s *state.State, name string, m manifest, target string, getDelta deltaSource, progressFunc func(Progress)) error {
+	rawName := strings.TrimSuffix(name, ".gz")
+
+	// Only the usr image is large enough to be worth a delta.
+	fields := strings.Split(rawName, ".")
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "usr-") || strings.Contains(fields[1], "-verity") {
+		return ErrDeltaUnavailable
+	}
+
+	osName, _, ok := strings.Cut(fields[0], "_")
+	if !ok || s == nil || s.OS.RunningRelease == "" {
+		return ErrDeltaUnavailable
+	}
+
+	// The manifest must cover both the delta and the reconstructed file.
+	deltaName := deltaAssetName(rawName, s.OS.RunningRelease)
+
+	_, err := m.checksum(deltaName)
+	if err != nil {
+		return ErrDeltaUnavailable
+	}
+
+	_, err = m.checksum(rawName)
+	if err != nil {
+		return ErrDeltaUnavailable
+	}
+
+	// Prefer the running /usr image, falling back to the image store.
+	reference := ""
+
+	_, err = os.Stat(runningUSRPath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		reference, err = systemd.GetRetainedOSFile(ctx, s.OS.RunningRelease, fmt.Sprintf("%s_%s.%s.*.raw", osName, s.OS.RunningRelease, fields[1]))
+		if err != nil {
+			if errors.Is(err, systemd.ErrImageNotRetained) {
+				return ErrDeltaUnavailable
+			}
+
+			return err
+		}
+	}
+
+	src, err := getDelta(ctx, deltaName)
+	if err != nil {
+		return err
+	}
+
+	// Download and validate the delta.
+	deltaPath := filepath.Join(StagingPath, deltaName)
+
+	err = fetchAsset(ctx, src, deltaName, m, deltaPath, false, progressFunc)
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(deltaPath)
+
+	// Copy the running /usr image next to the delta.
+	if reference == "" {
+		reference = deltaPath + ".ref"
+
+		defer os.Remove(reference)
+
+		err = copyRunningUSR(reference)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Reconstruct the full file next to the delta.
+	outputPath := deltaPath + ".out"
+
+	defer os.Remove(outputPath)
+
+	_, err = subprocess.RunCommandContext(ctx, "zstd", "-d", "-q", "-f", "--long=31", "--patch-from="+reference, deltaPath, "-o", outputPath)
+	if err != nil {
+		return err
+	}
+
+	// Validate the reconstructed file against the published checksum.
+	err = verifyStaged(outputPath, rawName, m)
+	if err != nil {
+		return err
+	}
+
+	return promoteStaged(outputPath, target, false)
+}
+
+// copyRunningUSR copies the /usr image of the running release into the provided path, as zstd
+// only accepts regular files as patch reference.
+func copyRunningUSR(path string) error {
+	// #nosec G304
+	src, err := os.Open(runningUSRPath)
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	// #nosec G304
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	defer fd.Close()
+
+	_, err = io.Copy(fd, src)
+	if err != nil {
+		return err
+	}
+
+	return fd.Close()
+}
@@ -0,0 +1,177 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lxc/incus-os/incus-osd/internal/state"
+	"github.com/lxc/incus-os/incus-osd/internal/systemd"
+)
+
+// addMirrorTestFiles publishes additional files in the release of a test mirror, re-signing its manifest.
+// Extra manifest entries can be provided for files which aren't published.
+func addMirrorTestFiles(t *testing.T, srv *mirrorTestServer, version string, files map[string][]byte, extra map[string][]byte) {
+	t.Helper()
+
+	key := newTestSigningKey(t)
+
+	index := mirrorIndex{}
+	require.NoError(t, json.Unmarshal(srv.files["index.json"], &index))
+
+	for name, data := range files {
+		srv.files[version+"/"+name] = data
+		index.Updates[0].Files = append(index.Updates[0].Files, mirrorFile{Filename: name})
+	}
+
+	body, err := json.Marshal(index)
+	require.NoError(t, err)
+
+	srv.files["index.json"] = body
+
+	// Sign the new manifest, covering everything published.
+	signed := map[string][]byte{}
+	for _, file := range index.Updates[0].Files {
+		signed[file.Filename] = srv.files[version+"/"+file.Filename]
+	}
+
+	for name, data := range extra {
+		signed[name] = data
+	}
+
+	sums, signature := signTestManifest(t, key, signed)
+	srv.files[version+"/"+manifestName] = sums
+	srv.files[version+"/"+manifestSignatureName] = signature
+}
+
+func TestDeltaUpdate(t *testing.T) { //nolint:paralleltest
+	_, err := exec.LookPath("zstd")
+	if err != nil {
+		t.Skip("zstd isn't available")
+	}
+
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	StagingPath = filepath.Join(tmpDir, "staging")
+	systemd.SystemImagesPath = filepath.Join(tmpDir, "images")
+
+	// Build two releases of the usr image, only differing slightly.
+	oldUsr := make([]byte, 0, 4*1024*1024)
+	for i := range 64 * 1024 {
+		oldUsr = fmt.Appendf(oldUsr, "block %d of the usr image\n", i)
+	}
+
+	newUsr := bytes.Clone(oldUsr)
+	copy(newUsr[1024*1024:], "updated package")
+
+	usrName := "IncusOS_202501010000.usr-x86-64.abcdef.raw"
+	osFiles := map[string][]byte{
+		"IncusOS_202501010000.efi": []byte("efi"),
+		usrName:                    newUsr,
+	}
+
+	// The running release.
+	runningUSRPath = filepath.Join(tmpDir, "usr")
+	t.Cleanup(func() { runningUSRPath = "/dev/mapper/usr" })
+
+	require.NoError(t, os.WriteFile(runningUSRPath, oldUsr, 0o600))
+
+	// Generate the delta.
+	deltaDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(deltaDir, "old"), oldUsr, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(deltaDir, "new"), newUsr, 0o600))
+
+	output, err := exec.CommandContext(ctx, "zstd", "-q", "--long=31", "--patch-from="+filepath.Join(deltaDir, "old"), filepath.Join(deltaDir, "new"), "-o", filepath.Join(deltaDir, "delta")).CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	delta, err := os.ReadFile(filepath.Join(deltaDir, "delta"))
+	require.NoError(t, err)
+	require.Less(t, len(delta), len(newUsr)/10)
+
+	// Publish the release along with the delta.
+	srv := newMirrorTestServer(t, "202501010000", osFiles)
+	deltaName := deltaAssetName(usrName, "202412310000")
+	addMirrorTestFiles(t, srv, "202501010000", map[string][]byte{deltaName: delta}, map[string][]byte{usrName: newUsr})
+
+	s := &state.State{}
+	s.OS.RunningRelease = "202412310000"
+
+	p, err := Load(ctx, s, "mirror", map[string]string{"url": srv.URL, "delta_updates": "true"})
+	require.NoError(t, err)
+
+	update, err := p.GetOSUpdate(ctx, "IncusOS", "")
+	require.NoError(t, err)
+
+	// The full usr image can't be fetched, so only the delta can be used.
+	fullUsr := srv.files["202501010000/"+usrName+".gz"]
+	delete(srv.files, "202501010000/"+usrName+".gz")
+
+	updatesPath := filepath.Join(tmpDir, "updates")
+	err = update.Download(ctx, "IncusOS", updatesPath, func(Progress) {})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(updatesPath, usrName))
+	require.NoError(t, err)
+	require.Equal(t, newUsr, data)
+
+	entries, err := os.ReadDir(updatesPath)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// A corrupted delta falls back to the full download.
+	srv.files["202501010000/"+usrName+".gz"] = fullUsr
+	srv.files["202501010000/"+deltaName] = []byte("corrupted")
+
+	err = update.Download(ctx, "IncusOS", updatesPath, func(Progress) {})
+	require.NoError(t, err)
+
+	data, err = os.ReadFile(filepath.Join(updatesPath, usrName))
+	require.NoError(t, err)
+	require.Equal(t, newUsr, data)
+
+	// Without the running /usr image, the retained one is used.
+	runningUSRPath = filepath.Join(tmpDir, "missing")
+
+	retainedPath := filepath.Join(systemd.SystemImagesPath, "os", "202412310000")
+	require.NoError(t, os.MkdirAll(retainedPath, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(retainedPath, "IncusOS_202412310000.usr-x86-64.123456.raw"), oldUsr, 0o600))
+
+	srv.files["202501010000/"+deltaName] = delta
+	delete(srv.files, "202501010000/"+usrName+".gz")
+
+	err = update.Download(ctx, "IncusOS", updatesPath, func(Progress) {})
+	require.NoError(t, err)
+
+	data, err = os.ReadFile(filepath.Join(updatesPath, usrName))
+	require.NoError(t, err)
+	require.Equal(t, newUsr, data)
+
+	// Otherwise the full image is downloaded.
+	srv.files["202501010000/"+usrName+".gz"] = fullUsr
+	s.OS.RunningRelease = "202412300000"
+	delete(srv.files, "202501010000/"+deltaName)
+
+	err = update.Download(ctx, "IncusOS", updatesPath, func(Progress) {})
+	require.NoError(t, err)
+
+	data, err = os.ReadFile(filepath.Join(updatesPath, usrName))
+	require.NoError(t, err)
+	require.Equal(t, newUsr, data)
+
+	// Deltas aren't part of the update itself.
+	size, err := update.DownloadSize(ctx, "IncusOS")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(srv.files["202501010000/IncusOS_202501010000.efi.gz"])+len(fullUsr)), size)
+
+	// Staging should be empty once everything is in place.
+	entries, err = os.ReadDir(StagingPath)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
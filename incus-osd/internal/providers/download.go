@@ -0,0 +1,420 @@
+package providers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StagingPath is where release assets are downloaded to before being validated and moved into place.
+var StagingPath = "/var/lib/incus-os/staging/"
+
+// staleStagingAge is how long an untouched partial download is kept around for resuming.
+var staleStagingAge = 24 * time.Hour
+
+// DownloadRateLimit returns the current download rate limit in bytes per second, zero meaning unlimited.
+// It's checked throughout downloads, so limits varying over time also apply to those in progress.
+var DownloadRateLimit = func() int64 { return 0 }
+
+// assetSource returns a reader for a release asset starting at the requested offset, along with
+// the offset actually used and the total size of the asset (or -1 if unknown). Sources which
+// can't resume a download must return a reader for the whole asset with an offset of zero.
+type assetSource func(ctx context.Context, offset int64) (io.ReadCloser, int64, int64, error)
+
+// CleanupStaging removes stale partial downloads from the staging directory.
+func CleanupStaging(_ context.Context) error {
+	entries, err := os.ReadDir(StagingPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return err
+		}
+
+		// Keep anything that's been recently written to, so interrupted downloads can be resumed.
+		if time.Since(info.ModTime()) < staleStagingAge {
+			continue
+		}
+
+		err = os.RemoveAll(filepath.Join(StagingPath, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// httpAssetSource returns an assetSource fetching the provided URL, using HTTP Range requests to resume downloads.
+func httpAssetSource(client *http.Client, assetURL string) assetSource {
+	return func(ctx context.Context, offset int64) (io.ReadCloser, int64, int64, error) {
+		// Prepare the request.
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, assetURL, nil)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+
+		// Get a reader for the release asset.
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			// The server doesn't support (or ignored) the range, start from scratch.
+			return resp.Body, 0, resp.ContentLength, nil
+
+		case http.StatusPartialContent:
+			if resp.ContentLength < 0 {
+				return resp.Body, offset, -1, nil
+			}
+
+			return resp.Body, offset, offset + resp.ContentLength, nil
+
+		case http.StatusRequestedRangeNotSatisfiable:
+			// The partial file is already complete.
+			_ = resp.Body.Close()
+
+			return io.NopCloser(bytes.NewReader(nil)), offset, offset, nil
+
+		default:
+			_ = resp.Body.Close()
+
+			return nil, 0, 0, fmt.Errorf("failed to fetch %q: %s", filepath.Base(req.URL.Path), resp.Status)
+		}
+	}
+}
+
+// httpAssetSize returns the size of the asset at the provided URL, or -1 if the server doesn't report it.
+func httpAssetSize(ctx context.Context, client *http.Client, assetURL string) (int64, error) {
+	// Prepare the request.
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, assetURL, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	// Query the release asset.
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to query %q: %s", filepath.Base(req.URL.Path), resp.Status)
+	}
+
+	return resp.ContentLength, nil
+}
+
+// fileAssetSize returns the size of a local release asset.
+func fileAssetSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// addAssetSize adds the size of an asset to a running total, either being -1 making the total unknown.
+func addAssetSize(total int64, size int64) int64 {
+	if total < 0 || size < 0 {
+		return -1
+	}
+
+	return total + size
+}
+
+// fileAssetSource returns an assetSource reading from a local file.
+func fileAssetSource(path string) assetSource {
+	return func(_ context.Context, offset int64) (io.ReadCloser, int64, int64, error) {
+		// Open the source.
+		// #nosec G304
+		src, err := os.Open(path)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+
+		// Get the file size.
+		s, err := src.Stat()
+		if err != nil {
+			_ = src.Close()
+
+			return nil, 0, 0, err
+		}
+
+		// Skip what was already copied.
+		if offset > s.Size() {
+			offset = 0
+		}
+
+		_, err = src.Seek(offset, io.SeekStart)
+		if err != nil {
+			_ = src.Close()
+
+			return nil, 0, 0, err
+		}
+
+		return src, offset, s.Size(), nil
+	}
+}
+
+// fetchAsset downloads (or resumes downloading) a release asset into the staging directory,
+// validates it against the release manifest, then atomically moves it into its target path.
+func fetchAsset(ctx context.Context, src assetSource, name string, m manifest, target string, decompress bool, progressFunc func(Progress)) error {
+	// Confirm the asset is covered by the manifest before fetching anything.
+	expectedHash, err := m.checksum(name)
+	if err != nil {
+		return err
+	}
+
+	// Create the staging path.
+	err = os.MkdirAll(StagingPath, 0o700)
+	if err != nil {
+		return err
+	}
+
+	// Partial downloads are named after their expected checksum so they can safely be resumed.
+	partialPath := filepath.Join(StagingPath, expectedHash+".partial")
+
+	offset := int64(0)
+
+	info, err := os.Stat(partialPath)
+	if err == nil {
+		offset = info.Size()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// Download into the staging file, preferring any peer cache.
+	src, fromPeer := peerAssetSource(ctx, expectedHash, src)
+
+	err = downloadStaged(ctx, src, name, partialPath, offset, progressFunc)
+	if err != nil {
+		// Don't resume what an untrusted peer sent from another source.
+		if fromPeer() {
+			_ = os.Remove(partialPath)
+		}
+
+		return err
+	}
+
+	// Validate the complete file.
+	err = verifyStaged(partialPath, name, m)
+	if err != nil {
+		_ = os.Remove(partialPath)
+
+		return err
+	}
+
+	// Serve the validated file to peers.
+	addPeerCache(ctx, partialPath, expectedHash)
+
+	// Move the validated file into place.
+	err = promoteStaged(partialPath, target, decompress)
+	if err != nil {
+		return err
+	}
+
+	// Remove the staging file if still present.
+	err = os.Remove(partialPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// downloadStaged writes the content of the asset source into the partial file, starting at the provided offset.
+func downloadStaged(ctx context.Context, src assetSource, name string, partialPath string, offset int64, progressFunc func(Progress)) error {
+	// Get a reader for the release asset.
+	rc, offset, srcSize, err := src(ctx, offset)
+	if err != nil {
+		return err
+	}
+
+	defer rc.Close()
+
+	// Open the partial file, discarding anything past the resume point.
+	// #nosec G304
+	fd, err := os.OpenFile(partialPath, os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	defer fd.Close()
+
+	err = fd.Truncate(offset)
+	if err != nil {
+		return err
+	}
+
+	_, err = fd.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	// Read in chunks to avoid excessive memory consumption.
+	var lastProgress time.Time
+
+	for {
+		// When rate limited, read about a second worth of data at a time.
+		limit := DownloadRateLimit()
+
+		chunkSize := int64(4 * 1024 * 1024)
+		if limit > 0 {
+			chunkSize = min(chunkSize, limit)
+		}
+
+		start := time.Now()
+
+		n, err := io.CopyN(fd, rc, chunkSize)
+		offset += n
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return err
+		}
+
+		// Wait until the chunk fits within the rate limit.
+		if limit > 0 {
+			wait := time.Duration(n)*time.Second/time.Duration(limit) - time.Since(start)
+			if wait > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		}
+
+		// Update progress every second.
+		if time.Since(lastProgress) >= time.Second {
+			progressFunc(Progress{Asset: name, Bytes: offset, Total: srcSize})
+			lastProgress = time.Now()
+		}
+	}
+
+	progressFunc(Progress{Asset: name, Bytes: offset, Total: max(srcSize, offset)})
+
+	// Make sure the data is on disk.
+	err = fd.Sync()
+	if err != nil {
+		return err
+	}
+
+	return fd.Close()
+}
+
+// verifyStaged checks a fully downloaded staging file against the release manifest.
+func verifyStaged(partialPath string, name string, m manifest) error {
+	// #nosec G304
+	fd, err := os.Open(partialPath)
+	if err != nil {
+		return err
+	}
+
+	defer fd.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, fd)
+	if err != nil {
+		return err
+	}
+
+	return m.verify(name, hash.Sum(nil))
+}
+
+// promoteStaged moves a validated staging file into its target path, decompressing it if needed.
+// The final file is always fully written and synced before being atomically renamed into place.
+func promoteStaged(partialPath string, target string, decompress bool) error {
+	if decompress {
+		// Open the compressed file.
+		// #nosec G304
+		src, err := os.Open(partialPath)
+		if err != nil {
+			return err
+		}
+
+		defer src.Close()
+
+		body, err := gzip.NewReader(src)
+		if err != nil {
+			return err
+		}
+
+		defer body.Close()
+
+		// Decompress into a temporary file in the staging directory.
+		fd, err := os.CreateTemp(StagingPath, filepath.Base(target)+".")
+		if err != nil {
+			return err
+		}
+
+		defer os.Remove(fd.Name())
+		defer fd.Close()
+
+		_, err = io.Copy(fd, body)
+		if err != nil {
+			return err
+		}
+
+		err = fd.Sync()
+		if err != nil {
+			return err
+		}
+
+		err = fd.Close()
+		if err != nil {
+			return err
+		}
+
+		partialPath = fd.Name()
+	}
+
+	// Atomically move the file into place.
+	err := os.Rename(partialPath, target)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the rename itself is persisted.
+	dir, err := os.Open(filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+
+	defer dir.Close()
+
+	return dir.Sync()
+}
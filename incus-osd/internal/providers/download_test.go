@@ -0,0 +1,186 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPAssetSource(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	data := []byte("0123456789")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ranged", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "ranged", time.Time{}, bytes.NewReader(data))
+	})
+	mux.HandleFunc("/full", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(data)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	read := func(rc io.ReadCloser) []byte {
+		defer rc.Close()
+
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+
+		return content
+	}
+
+	// A fresh download.
+	rc, offset, size, err := httpAssetSource(srv.Client(), srv.URL+"/ranged")(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), offset)
+	require.Equal(t, int64(10), size)
+	require.Equal(t, data, read(rc))
+
+	// A resumed download (206).
+	rc, offset, size, err = httpAssetSource(srv.Client(), srv.URL+"/ranged")(ctx, 4)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), offset)
+	require.Equal(t, int64(10), size)
+	require.Equal(t, data[4:], read(rc))
+
+	// An already complete download (416).
+	rc, offset, size, err = httpAssetSource(srv.Client(), srv.URL+"/ranged")(ctx, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), offset)
+	require.Equal(t, int64(10), size)
+	require.Empty(t, read(rc))
+
+	// A server ignoring the range (200) restarts from scratch.
+	rc, offset, size, err = httpAssetSource(srv.Client(), srv.URL+"/full")(ctx, 4)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), offset)
+	require.Equal(t, int64(10), size)
+	require.Equal(t, data, read(rc))
+
+	// Errors are reported.
+	_, _, _, err = httpAssetSource(srv.Client(), srv.URL+"/missing")(ctx, 0)
+	require.ErrorContains(t, err, "404")
+}
+
+func TestFetchAssetResume(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	StagingPath = filepath.Join(tmpDir, "staging")
+
+	data := bytes.Repeat([]byte("incus"), 1000)
+	hash := sha256.Sum256(data)
+	m := manifest{"incus.raw": hex.EncodeToString(hash[:])}
+	partialPath := filepath.Join(StagingPath, m["incus.raw"]+".partial")
+	target := filepath.Join(tmpDir, "incus.raw")
+
+	var ranges []string
+
+	truncate := false
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+
+		// Drop the connection half way through.
+		if truncate {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			_, _ = w.Write(data[:len(data)/2])
+
+			return
+		}
+
+		http.ServeContent(w, r, "incus.raw", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(srv.Close)
+
+	src := httpAssetSource(srv.Client(), srv.URL)
+
+	// A truncated download is kept for resuming.
+	truncate = true
+
+	err := fetchAsset(ctx, src, "incus.raw", m, target, false, func(Progress) {})
+	require.Error(t, err)
+	require.NoFileExists(t, target)
+
+	info, err := os.Stat(partialPath)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)/2), info.Size())
+
+	// Then resumed from where it stopped.
+	truncate = false
+
+	err = fetchAsset(ctx, src, "incus.raw", m, target, false, func(Progress) {})
+	require.NoError(t, err)
+	require.Equal(t, []string{"", "bytes=" + strconv.Itoa(len(data)/2) + "-"}, ranges)
+	require.NoFileExists(t, partialPath)
+
+	content, err := os.ReadFile(target)
+	require.NoError(t, err)
+	require.Equal(t, data, content)
+
+	// A complete partial download only needs to be validated.
+	require.NoError(t, os.WriteFile(partialPath, data, 0o600))
+	require.NoError(t, os.Remove(target))
+
+	err = fetchAsset(ctx, src, "incus.raw", m, target, false, func(Progress) {})
+	require.NoError(t, err)
+
+	content, err = os.ReadFile(target)
+	require.NoError(t, err)
+	require.Equal(t, data, content)
+
+	// An invalid partial download is discarded.
+	require.NoError(t, os.WriteFile(partialPath, []byte("evil"), 0o600))
+	require.NoError(t, os.Remove(target))
+
+	err = fetchAsset(ctx, src, "incus.raw", m, target, false, func(Progress) {})
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+	require.NoFileExists(t, partialPath)
+	require.NoFileExists(t, target)
+
+	// Files missing from the manifest are never fetched.
+	ranges = nil
+
+	err = fetchAsset(ctx, src, "debug.raw", m, target, false, func(Progress) {})
+	require.ErrorIs(t, err, ErrNotInManifest)
+	require.Empty(t, ranges)
+}
+
+func TestCleanupStaging(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	StagingPath = filepath.Join(t.TempDir(), "staging")
+
+	// A missing staging directory is fine.
+	err := CleanupStaging(ctx)
+	require.NoError(t, err)
+
+	// Only stale partial downloads are removed.
+	require.NoError(t, os.MkdirAll(StagingPath, 0o700))
+
+	stalePath := filepath.Join(StagingPath, "stale.partial")
+	require.NoError(t, os.WriteFile(stalePath, []byte("stale"), 0o600))
+
+	staleTime := time.Now().Add(-2 * staleStagingAge)
+	require.NoError(t, os.Chtimes(stalePath, staleTime, staleTime))
+
+	recentPath := filepath.Join(StagingPath, "recent.partial")
+	require.NoError(t, os.WriteFile(recentPath, []byte("recent"), 0o600))
+
+	err = CleanupStaging(ctx)
+	require.NoError(t, err)
+	require.NoFileExists(t, stalePath)
+	require.FileExists(t, recentPath)
+}
@@ -2,6 +2,7 @@ package providers
 
 import (
 	"errors"
+	"net"
 )
 
 // ErrProviderUnavailable is returned when a provider isn't ready for use yet.
@@ -12,3 +13,33 @@ var ErrNoUpdateAvailable = errors.New("no update available")
 
 // ErrRegistrationUnsupported is returned if the provider doesn't (currently) support registration.
 var ErrRegistrationUnsupported = errors.New("registration unsupported")
+
+// ErrInvalidSignature is returned when a release manifest fails signature validation.
+var ErrInvalidSignature = errors.New("invalid release manifest signature")
+
+// ErrChecksumMismatch is returned when a downloaded file doesn't match the release manifest.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrNotInManifest is returned when a file isn't listed in the release manifest.
+var ErrNotInManifest = errors.New("file missing from release manifest")
+
+// ErrInvalidBundle is returned when an update bundle is malformed or doesn't match its manifest.
+var ErrInvalidBundle = errors.New("invalid update bundle")
+
+// ErrBundleInUse is returned when replacing or removing an update bundle while it's being applied.
+var ErrBundleInUse = errors.New("an update bundle is currently being applied")
+
+// ErrDeltaUnavailable is returned when an OS update file can't be reconstructed from a delta and must be fully downloaded.
+var ErrDeltaUnavailable = errors.New("no usable update delta")
+
+// IsUnavailable checks whether the provided error indicates that a provider can't currently be reached,
+// in which case the next provider should be tried.
+func IsUnavailable(err error) bool {
+	if errors.Is(err, ErrProviderUnavailable) {
+		return true
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr)
+}
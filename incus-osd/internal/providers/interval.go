@@ -0,0 +1,64 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// DefaultCheckInterval is the time between update checks when none is configured.
+var DefaultCheckInterval = 6 * time.Hour
+
+// ErrInvalidCheckInterval is returned when the configured update check interval can't be used.
+var ErrInvalidCheckInterval = errors.New("invalid update check interval")
+
+// defaultCheckIntervals holds the default interval of providers which are cheap to check.
+var defaultCheckIntervals = map[string]time.Duration{
+	"removable": 15 * time.Minute,
+}
+
+const (
+	minCheckInterval = time.Minute
+	minRetryDelay    = time.Minute
+)
+
+// CheckInterval returns the update check interval for a provider, taken from its "update_interval"
+// configuration key when set.
+func CheckInterval(name string, config map[string]string) (time.Duration, error) {
+	value, ok := config["update_interval"]
+	if !ok || value == "" {
+		interval, ok := defaultCheckIntervals[name]
+		if ok {
+			return interval, nil
+		}
+
+		return DefaultCheckInterval, nil
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w %q: %w", ErrInvalidCheckInterval, value, err)
+	}
+
+	if interval < minCheckInterval {
+		return 0, fmt.Errorf("%w %q: must be at least %s", ErrInvalidCheckInterval, value, minCheckInterval)
+	}
+
+	return interval, nil
+}
+
+// CheckDelay returns how long to wait until the next update check. The interval gets up to 10% of
+// random jitter so systems started at the same time don't all hit the provider at once. After
+// consecutive transient failures, the check is instead retried with an exponential backoff.
+func CheckDelay(interval time.Duration, failures int) time.Duration {
+	delay := interval
+
+	if failures > 0 {
+		delay = min(interval, minRetryDelay<<min(failures-1, 16))
+	}
+
+	jitter := time.Duration(rand.Int64N(int64(delay)/5+1)) - delay/10 //nolint:gosec
+
+	return delay + jitter
+}
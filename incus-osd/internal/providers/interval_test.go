@@ -0,0 +1,52 @@
+package providers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckInterval(t *testing.T) {
+	t.Parallel()
+
+	interval, err := CheckInterval("github", nil)
+	require.NoError(t, err)
+	require.Equal(t, DefaultCheckInterval, interval)
+
+	interval, err = CheckInterval("removable", nil)
+	require.NoError(t, err)
+	require.Equal(t, 15*time.Minute, interval)
+
+	interval, err = CheckInterval("github", map[string]string{"update_interval": "1h30m"})
+	require.NoError(t, err)
+	require.Equal(t, 90*time.Minute, interval)
+
+	for _, value := range []string{"soon", "10s", "-1h"} {
+		_, err = CheckInterval("github", map[string]string{"update_interval": value})
+		require.ErrorIs(t, err, ErrInvalidCheckInterval)
+	}
+}
+
+func TestCheckDelay(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, 6 * time.Hour},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{5, 16 * time.Minute},
+		{20, 6 * time.Hour},
+	}
+
+	for _, test := range tests {
+		for range 100 {
+			delay := CheckDelay(6*time.Hour, test.failures)
+			require.GreaterOrEqual(t, delay, test.expected-test.expected/10)
+			require.LessOrEqual(t, delay, test.expected+test.expected/10)
+		}
+	}
+}
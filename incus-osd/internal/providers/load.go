@@ -4,37 +4,89 @@ import (
 	"context"
 	"fmt"
 	"slices"
+	"strconv"
+
+	"github.com/lxc/incus-os/incus-osd/internal/state"
 )
 
 // Load gets a specific provider and initializes it with the provider configuration.
-func Load(ctx context.Context, name string, config map[string]string) (Provider, error) {
-	if !slices.Contains([]string{"github", "local", "operations-center"}, name) {
+func Load(ctx context.Context, s *state.State, name string, config map[string]string) (Provider, error) {
+	if !slices.Contains([]string{"bundle", "github", "local", "mirror", "oci", "operations-center", "peer", "removable"}, name) {
 		return nil, fmt.Errorf("unknown provider %q", name)
 	}
 
+	// Validate the configuration common to all providers.
+	_, err := CheckInterval(name, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config["delta_updates"] != "" {
+		_, err = strconv.ParseBool(config["delta_updates"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid delta_updates value %q", config["delta_updates"])
+		}
+	}
+
 	var p Provider
 
 	switch name {
+	case "bundle":
+		// Setup the Bundle provider.
+		p = &bundle{
+			config: config,
+		}
+
 	case "github":
 		// Setup the Github provider.
 		p = &github{
 			config: config,
+			state:  s,
 		}
 
 	case "local":
-		// Setup the Github provider.
+		// Setup the Local provider.
 		p = &local{
 			config: config,
+			state:  s,
+		}
+
+	case "mirror":
+		// Setup the Mirror provider.
+		p = &mirror{
+			config: config,
+			state:  s,
+		}
+
+	case "oci":
+		// Setup the OCI registry provider.
+		p = &oci{
+			config: config,
+			state:  s,
 		}
 
 	case "operations-center":
 		// Setup the Operations Center provider.
 		p = &operationsCenter{
 			config: config,
+			state:  s,
+		}
+
+	case "peer":
+		// Setup the Peer provider.
+		p = &peer{
+			config: config,
+			state:  s,
+		}
+
+	case "removable":
+		// Setup the Removable media provider.
+		p = &removable{
+			config: config,
 		}
 	}
 
-	err := p.load(ctx)
+	err = p.load(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,135 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// manifestName is the name of the checksum file published alongside each release.
+var manifestName = "SHA256SUMS"
+
+// manifestSignatureName is the name of the detached signature of the checksum file.
+var manifestSignatureName = "SHA256SUMS.sig"
+
+// manifestCertificatePath is the certificate used to validate the manifest signature.
+// It's shipped as part of the (verity protected) /usr image.
+var manifestCertificatePath = "/usr/lib/incus-osd/update.crt"
+
+// manifest holds the expected SHA256 checksum of each file in a release.
+type manifest map[string]string
+
+// parseManifest validates the signature of a SHA256SUMS file and returns the parsed manifest.
+func parseManifest(body []byte, signature []byte) (manifest, error) {
+	// Validate the signature.
+	err := verifyManifestSignature(body, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the content, expecting the usual "<hash>  <filename>" format.
+	m := manifest{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid manifest line %q", line)
+		}
+
+		hash := strings.ToLower(fields[0])
+		if len(hash) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid manifest checksum %q", fields[0])
+		}
+
+		m[strings.TrimPrefix(fields[1], "*")] = hash
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(m) == 0 {
+		return nil, errors.New("empty release manifest")
+	}
+
+	return m, nil
+}
+
+// checksum returns the expected checksum for the provided file name.
+func (m manifest) checksum(name string) (string, error) {
+	hash, ok := m[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrNotInManifest, name)
+	}
+
+	return hash, nil
+}
+
+// verify compares a computed checksum against the one recorded in the manifest.
+func (m manifest) verify(name string, sum []byte) error {
+	expected, err := m.checksum(name)
+	if err != nil {
+		return err
+	}
+
+	actual := hex.EncodeToString(sum)
+	if actual != expected {
+		return fmt.Errorf("%w for %q (expected %s, got %s)", ErrChecksumMismatch, name, expected, actual)
+	}
+
+	return nil
+}
+
+// verifyManifestSignature checks the detached signature of the manifest against the trusted certificate.
+func verifyManifestSignature(body []byte, signature []byte) error {
+	// Load the trusted certificate.
+	content, err := os.ReadFile(manifestCertificatePath)
+	if err != nil {
+		return fmt.Errorf("failed to load the update signing certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(content)
+	if block != nil {
+		content = block.Bytes
+	}
+
+	cert, err := x509.ParseCertificate(content)
+	if err != nil {
+		return fmt.Errorf("failed to parse the update signing certificate: %w", err)
+	}
+
+	// Pick the signature algorithm matching the key.
+	var algo x509.SignatureAlgorithm
+
+	switch cert.PublicKeyAlgorithm {
+	case x509.RSA:
+		algo = x509.SHA256WithRSA
+	case x509.ECDSA:
+		algo = x509.ECDSAWithSHA256
+	case x509.Ed25519:
+		algo = x509.PureEd25519
+	default:
+		return fmt.Errorf("unsupported update signing key type %q", cert.PublicKeyAlgorithm)
+	}
+
+	err = cert.CheckSignature(algo, body, signature)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package providers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// signTestBody signs an arbitrary manifest body with the provided key.
+func signTestBody(t *testing.T, key *ecdsa.PrivateKey, body string) []byte {
+	t.Helper()
+
+	digest := sha256.Sum256([]byte(body))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+
+	return signature
+}
+
+func TestParseManifest(t *testing.T) { //nolint:paralleltest
+	key := newTestSigningKey(t)
+
+	hashA := strings.Repeat("a", 64)
+	hashB := strings.Repeat("B", 64)
+
+	// Both the text and binary modes of sha256sum are accepted, along with blank lines.
+	body := hashA + "  incus.raw.gz\n\n" + hashB + " *IncusOS_202501010000.efi.gz\n"
+
+	m, err := parseManifest([]byte(body), signTestBody(t, key, body))
+	require.NoError(t, err)
+	require.Equal(t, manifest{
+		"incus.raw.gz":                hashA,
+		"IncusOS_202501010000.efi.gz": strings.ToLower(hashB),
+	}, m)
+
+	// Invalid content is rejected, even when properly signed.
+	for _, body := range []string{
+		"",
+		"\n\n",
+		hashA + "\n",
+		hashA + "  incus.raw.gz extra\n",
+		"abcd  incus.raw.gz\n",
+	} {
+		_, err = parseManifest([]byte(body), signTestBody(t, key, body))
+		require.Error(t, err, body)
+		require.NotErrorIs(t, err, ErrInvalidSignature, body)
+	}
+}
+
+func TestVerifyManifestSignature(t *testing.T) { //nolint:paralleltest
+	key := newTestSigningKey(t)
+
+	body := strings.Repeat("a", 64) + "  incus.raw.gz\n"
+	signature := signTestBody(t, key, body)
+
+	err := verifyManifestSignature([]byte(body), signature)
+	require.NoError(t, err)
+
+	// Tampered content.
+	err = verifyManifestSignature([]byte(strings.Repeat("b", 64)+"  incus.raw.gz\n"), signature)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = parseManifest([]byte(strings.Repeat("b", 64)+"  incus.raw.gz\n"), signature)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Invalid or missing signature.
+	err = verifyManifestSignature([]byte(body), []byte("invalid"))
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	err = verifyManifestSignature([]byte(body), nil)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Signed by another key.
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	err = verifyManifestSignature([]byte(body), signTestBody(t, otherKey, body))
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Invalid or missing certificate.
+	require.NoError(t, os.WriteFile(manifestCertificatePath, []byte("invalid"), 0o600))
+
+	err = verifyManifestSignature([]byte(body), signature)
+	require.ErrorContains(t, err, "failed to parse the update signing certificate")
+
+	manifestCertificatePath = filepath.Join(t.TempDir(), "missing.crt")
+
+	err = verifyManifestSignature([]byte(body), signature)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestManifestChecksum(t *testing.T) {
+	t.Parallel()
+
+	sum := sha256.Sum256([]byte("incus"))
+	m := manifest{"incus.raw.gz": strings.Repeat("a", 64)}
+
+	hash, err := m.checksum("incus.raw.gz")
+	require.NoError(t, err)
+	require.Equal(t, m["incus.raw.gz"], hash)
+
+	_, err = m.checksum("debug.raw.gz")
+	require.ErrorIs(t, err, ErrNotInManifest)
+
+	// Verification against the recorded checksum.
+	err = m.verify("incus.raw.gz", sum[:])
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+
+	m["incus.raw.gz"] = hex.EncodeToString(sum[:])
+
+	err = m.verify("incus.raw.gz", sum[:])
+	require.NoError(t, err)
+
+	err = m.verify("debug.raw.gz", sum[:])
+	require.ErrorIs(t, err, ErrNotInManifest)
+}
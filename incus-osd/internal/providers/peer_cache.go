@@ -0,0 +1,289 @@
+package providers
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PeerCachePath is where verified release files are kept for serving to peers.
+var PeerCachePath = "/var/lib/incus-os/peer-cache/"
+
+// DefaultPeerCachePort is the port the peer cache listens on when the configured address doesn't include one.
+var DefaultPeerCachePort = "8444"
+
+// peerCacheMaxAge is how long a release file is served to peers after being downloaded.
+var peerCacheMaxAge = 30 * 24 * time.Hour
+
+// peerCacheMaxSize is the total size of the release files served to peers, roughly covering the running
+// and next releases. The oldest files are removed first when going over it.
+var peerCacheMaxSize = int64(8 * 1024 * 1024 * 1024)
+
+// peerCacheMu serializes changes to the peer cache.
+var peerCacheMu sync.Mutex
+
+// peerCacheEnabled controls whether verified release files get added to the peer cache.
+var peerCacheEnabled atomic.Bool
+
+// PeerCacheServer serves the release files verified by this system to other systems on the local network.
+// Files are addressed by their SHA256 checksum, which peers then validate against their own release manifest.
+type PeerCacheServer struct {
+	address string
+	server  *http.Server
+
+	mu sync.Mutex
+}
+
+// Update starts, restarts or stops the peer cache to match the provided configuration and
+// removes files which shouldn't be served anymore.
+func (c *PeerCacheServer) Update(ctx context.Context, enabled bool, address string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if enabled {
+		var err error
+
+		address, err = PeerCacheAddress(address)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Stop the current server if disabled or moving to a different address.
+	if c.server != nil && (!enabled || address != c.address) {
+		peerCacheEnabled.Store(false)
+
+		err := c.server.Close()
+		if err != nil {
+			return err
+		}
+
+		c.server = nil
+
+		slog.InfoContext(ctx, "Stopped the peer update cache", "address", c.address)
+	}
+
+	if !enabled {
+		// Clear the cache.
+		return os.RemoveAll(PeerCachePath)
+	}
+
+	err := cleanupPeerCache()
+	if err != nil {
+		return err
+	}
+
+	if c.server != nil {
+		return nil
+	}
+
+	// Start the server.
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	c.address = address
+	c.server = &http.Server{
+		Handler: newPeerCacheHandler(),
+
+		ReadTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		err := c.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Peer update cache failed", "err", err.Error())
+		}
+	}()
+
+	peerCacheEnabled.Store(true)
+
+	slog.InfoContext(ctx, "Started the peer update cache", "address", address)
+
+	return nil
+}
+
+// PeerCacheAddress validates the configured peer cache address, returning it with its port. As the cache isn't
+// authenticated, it must be bound to the IP address of a local network interface rather than all of them.
+func PeerCacheAddress(address string) (string, error) {
+	if address == "" {
+		return "", errors.New("the peer cache requires an address to listen on")
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host = strings.Trim(address, "[]")
+		port = DefaultPeerCachePort
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsUnspecified() {
+		return "", fmt.Errorf("invalid peer cache address %q, an IP address of a local network interface is required", address)
+	}
+
+	return net.JoinHostPort(ip.String(), port), nil
+}
+
+// privateAssetsKey is the context key marking downloads from providers requiring credentials.
+type privateAssetsKey struct{}
+
+// withPrivateAssets returns a context keeping the downloaded release files out of the peer cache,
+// so files only available with credentials aren't served to anyone reaching the cache.
+func withPrivateAssets(ctx context.Context) context.Context {
+	return context.WithValue(ctx, privateAssetsKey{}, true)
+}
+
+// newPeerCacheHandler returns the HTTP handler of the peer cache.
+func newPeerCacheHandler() http.Handler {
+	router := http.NewServeMux()
+	router.HandleFunc("/1.0/cache/{hash}", servePeerCache)
+
+	return router
+}
+
+// servePeerCache returns a cached release file.
+func servePeerCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	// Only accept valid checksums, so nothing outside of the cache can be reached.
+	hash := r.PathValue("hash")
+
+	_, err := hex.DecodeString(hash)
+	if err != nil || len(hash) != 64 {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	// #nosec G304
+	fd, err := os.Open(filepath.Join(PeerCachePath, hash))
+	if err != nil {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	defer fd.Close()
+
+	info, err := fd.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	// Serve the file, supporting resumed downloads.
+	http.ServeContent(w, r, hash, info.ModTime(), fd)
+}
+
+// addPeerCache adds a verified staging file to the peer cache, if enabled and not from a provider requiring credentials.
+func addPeerCache(ctx context.Context, partialPath string, hash string) {
+	private, _ := ctx.Value(privateAssetsKey{}).(bool)
+	if !peerCacheEnabled.Load() || private {
+		return
+	}
+
+	err := os.MkdirAll(PeerCachePath, 0o700)
+	if err != nil {
+		slog.Warn("Failed to create the peer update cache", "err", err.Error())
+
+		return
+	}
+
+	// Staging files are moved into place or removed, so link them into the cache,
+	// replacing any previous copy.
+	tmpPath := filepath.Join(PeerCachePath, "."+hash)
+
+	_ = os.Remove(tmpPath)
+
+	err = os.Link(partialPath, tmpPath)
+	if err == nil {
+		err = os.Rename(tmpPath, filepath.Join(PeerCachePath, hash))
+	}
+
+	if err != nil {
+		slog.Warn("Failed to add file to the peer update cache", "err", err.Error())
+
+		return
+	}
+
+	// Make room for the new file.
+	err = cleanupPeerCache()
+	if err != nil {
+		slog.Warn("Failed to cleanup the peer update cache", "err", err.Error())
+	}
+}
+
+// cleanupPeerCache removes the files which were added to the peer cache too long ago, as well as the oldest
+// ones not fitting within its maximum size. The most recent file is kept regardless of its size.
+func cleanupPeerCache() error {
+	peerCacheMu.Lock()
+	defer peerCacheMu.Unlock()
+
+	entries, err := os.ReadDir(PeerCachePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	files := make([]os.FileInfo, 0, len(entries))
+
+	for _, entry := range entries {
+		// Skip files being added.
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return err
+		}
+
+		files = append(files, info)
+	}
+
+	// Go through the files from newest to oldest.
+	slices.SortFunc(files, func(a os.FileInfo, b os.FileInfo) int {
+		return b.ModTime().Compare(a.ModTime())
+	})
+
+	size := int64(0)
+
+	for i, info := range files {
+		size += info.Size()
+
+		if time.Since(info.ModTime()) < peerCacheMaxAge && (i == 0 || size <= peerCacheMaxSize) {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(PeerCachePath, info.Name()))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
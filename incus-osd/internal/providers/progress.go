@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"sync"
+	"time"
+)
+
+// UpdateProgress reports the download progress of an update, aggregated over all its assets.
+type UpdateProgress struct {
+	// Bytes downloaded so far out of the total size of the update (-1 if unknown).
+	Bytes int64
+	Total int64
+
+	// Current download rate in bytes per second.
+	Rate int64
+
+	// Estimated time until the download completes (-1 if unknown).
+	ETA time.Duration
+}
+
+// Fraction returns the downloaded fraction of the update, zero if the total size isn't known.
+func (p UpdateProgress) Fraction() float64 {
+	if p.Total <= 0 {
+		return 0
+	}
+
+	return min(float64(p.Bytes)/float64(p.Total), 1)
+}
+
+// ProgressTracker aggregates the progress of the individual assets of an update.
+type ProgressTracker struct {
+	total  int64
+	assets map[string]int64
+	report func(UpdateProgress)
+
+	// Smoothed download rate and the last sample it was computed from.
+	rate      float64
+	lastBytes int64
+	lastTime  time.Time
+
+	mu sync.Mutex
+}
+
+// NewProgressTracker returns a tracker for an update of the provided total size (-1 if unknown),
+// calling the report function whenever the progress of one of its assets changes.
+func NewProgressTracker(total int64, report func(UpdateProgress)) *ProgressTracker {
+	return &ProgressTracker{
+		total:  total,
+		assets: map[string]int64{},
+		report: report,
+	}
+}
+
+// Update records the progress of one of the assets, for use as the progress function of a download.
+func (t *ProgressTracker) Update(p Progress) {
+	t.mu.Lock()
+
+	t.assets[p.Asset] = p.Bytes
+
+	bytes := int64(0)
+	for _, assetBytes := range t.assets {
+		bytes += assetBytes
+	}
+
+	// Update the download rate, smoothing it over the recent samples. Restarted downloads reset the baseline.
+	now := time.Now()
+	elapsed := now.Sub(t.lastTime).Seconds()
+
+	if !t.lastTime.IsZero() && bytes >= t.lastBytes && elapsed > 0 {
+		sample := float64(bytes-t.lastBytes) / elapsed
+
+		if t.rate == 0 {
+			t.rate = sample
+		} else {
+			t.rate = 0.7*t.rate + 0.3*sample
+		}
+	}
+
+	t.lastBytes = bytes
+	t.lastTime = now
+
+	progress := UpdateProgress{
+		Bytes: bytes,
+		Total: t.total,
+		Rate:  int64(t.rate),
+		ETA:   -1,
+	}
+
+	if t.total > 0 && t.rate > 0 {
+		progress.ETA = time.Duration(float64(max(t.total-bytes, 0)) / t.rate * float64(time.Second)).Round(time.Second)
+	}
+
+	t.mu.Unlock()
+
+	t.report(progress)
+}
@@ -0,0 +1,40 @@
+package providers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressTracker(t *testing.T) {
+	t.Parallel()
+
+	reports := []UpdateProgress{}
+	tracker := NewProgressTracker(300, func(p UpdateProgress) { reports = append(reports, p) })
+
+	// The first report can't have a rate yet.
+	tracker.Update(Progress{Asset: "a", Bytes: 50, Total: 100})
+	require.Equal(t, UpdateProgress{Bytes: 50, Total: 300, ETA: -1}, reports[0])
+
+	// Progress is aggregated over all assets.
+	time.Sleep(10 * time.Millisecond)
+	tracker.Update(Progress{Asset: "a", Bytes: 100, Total: 100})
+	tracker.Update(Progress{Asset: "b", Bytes: 100, Total: 200})
+
+	last := reports[len(reports)-1]
+	require.Equal(t, int64(200), last.Bytes)
+	require.InDelta(t, 2.0/3.0, last.Fraction(), 0.0001)
+	require.Positive(t, last.Rate)
+	require.GreaterOrEqual(t, last.ETA, time.Duration(0))
+
+	// Unknown totals don't have a fraction or ETA.
+	tracker = NewProgressTracker(-1, func(p UpdateProgress) { reports = append(reports, p) })
+	tracker.Update(Progress{Asset: "a", Bytes: 50, Total: 100})
+	time.Sleep(10 * time.Millisecond)
+	tracker.Update(Progress{Asset: "a", Bytes: 100, Total: 100})
+
+	last = reports[len(reports)-1]
+	require.Zero(t, last.Fraction())
+	require.Equal(t, time.Duration(-1), last.ETA)
+}
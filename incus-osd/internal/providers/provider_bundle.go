@@ -0,0 +1,93 @@
+package providers
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// The Bundle provider, serving an update bundle uploaded through the API.
+type bundle struct {
+	config map[string]string
+
+	releaseAssets   []string
+	releaseManifest manifest
+	releaseVersion  string
+}
+
+func (*bundle) ClearCache(_ context.Context) error {
+	// No cache for the bundle provider.
+	return nil
+}
+
+func (*bundle) Register(_ context.Context) error {
+	// No registration with the bundle provider.
+	return ErrRegistrationUnsupported
+}
+
+func (*bundle) Type() string {
+	return "bundle"
+}
+
+func (*bundle) Channel() string {
+	// Uploaded bundles aren't tied to a channel.
+	return ""
+}
+
+func (p *bundle) GetOSUpdate(ctx context.Context, osName string, version string) (OSUpdate, error) {
+	// Get the uploaded release.
+	err := p.checkRelease(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only a single release is available.
+	if version != "" && !SameVersion(version, p.releaseVersion) {
+		return nil, ErrNoUpdateAvailable
+	}
+
+	return getBundleOSUpdate(p, osName, p.releaseVersion, p.releaseAssets, p.releaseManifest)
+}
+
+func (p *bundle) GetApplication(ctx context.Context, name string, version string) (Application, error) {
+	// Get the uploaded release.
+	err := p.checkRelease(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only a single release is available.
+	if version != "" && !SameVersion(version, p.releaseVersion) {
+		return nil, ErrNoUpdateAvailable
+	}
+
+	return getBundleApplication(p, name, p.releaseVersion, p.releaseAssets, p.releaseManifest)
+}
+
+func (*bundle) load(_ context.Context) error {
+	return nil
+}
+
+// withBundle gives access to the uploaded bundle for the duration of the provided function.
+func (*bundle) withBundle(_ context.Context, f func(root string) error) error {
+	// Don't let uploads replace the bundle while it's being read.
+	stagedBundle.mu.Lock()
+	defer stagedBundle.mu.Unlock()
+
+	return f(filepath.Clean(BundlePath))
+}
+
+func (p *bundle) checkRelease(ctx context.Context) error {
+	return p.withBundle(ctx, func(root string) error {
+		version, assets, m, err := readBundle(root)
+		if err != nil {
+			return err
+		}
+
+		// Record the release.
+		p.releaseVersion = version
+		p.releaseAssets = assets
+		p.releaseManifest = m
+
+		return nil
+	})
+}
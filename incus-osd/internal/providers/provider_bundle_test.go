@@ -0,0 +1,225 @@
+package providers
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBundle returns a signed update bundle tarball holding the provided files.
+func newTestBundle(t *testing.T, version string, content map[string][]byte, extra map[string][]byte) []byte {
+	t.Helper()
+
+	key := newTestSigningKey(t)
+
+	files := gzipTestFiles(t, content)
+	files["RELEASE"] = []byte(version + "\n")
+	sums, signature := signTestManifest(t, key, files)
+	files[manifestName] = sums
+	files[manifestSignatureName] = signature
+
+	for name, data := range extra {
+		files[name] = data
+	}
+
+	return tarTestFiles(t, files)
+}
+
+// tarTestFiles returns a tarball holding the provided files.
+func tarTestFiles(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+
+	for name, data := range files {
+		err := tw.WriteHeader(&tar.Header{Name: "./" + name, Mode: 0o600, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		require.NoError(t, err)
+
+		_, err = tw.Write(data)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tw.Close())
+
+	return buf.Bytes()
+}
+
+func TestBundleUpdate(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	StagingPath = filepath.Join(tmpDir, "staging")
+	BundlePath = filepath.Join(tmpDir, "bundle")
+
+	files := map[string][]byte{
+		"IncusOS_202501010000.efi": []byte("efi"),
+		"incus.raw":                []byte("incus"),
+	}
+
+	// Import the bundle.
+	version, err := ImportBundle(ctx, bytes.NewReader(newTestBundle(t, "202501010000", files, nil)))
+	require.NoError(t, err)
+	require.Equal(t, "202501010000", version)
+
+	p, err := Load(ctx, nil, "bundle", nil)
+	require.NoError(t, err)
+
+	// Apply the OS update.
+	update, err := p.GetOSUpdate(ctx, "IncusOS", "")
+	require.NoError(t, err)
+	require.Equal(t, "202501010000", update.Version())
+
+	size, err := update.DownloadSize(ctx, "IncusOS")
+	require.NoError(t, err)
+	require.Positive(t, size)
+
+	updatesPath := filepath.Join(tmpDir, "updates")
+	err = update.Download(ctx, "IncusOS", updatesPath, func(Progress) {})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(updatesPath, "IncusOS_202501010000.efi"))
+	require.NoError(t, err)
+	require.Equal(t, files["IncusOS_202501010000.efi"], data)
+
+	// Apply the application update.
+	app, err := p.GetApplication(ctx, "incus", "")
+	require.NoError(t, err)
+
+	extensionsPath := filepath.Join(tmpDir, "extensions")
+	err = app.Download(ctx, extensionsPath, func(Progress) {})
+	require.NoError(t, err)
+
+	data, err = os.ReadFile(filepath.Join(extensionsPath, "incus.raw"))
+	require.NoError(t, err)
+	require.Equal(t, files["incus.raw"], data)
+
+	// Once removed, nothing is offered anymore.
+	require.NoError(t, RemoveBundle(ctx))
+
+	_, err = p.GetApplication(ctx, "incus", "")
+	require.ErrorIs(t, err, ErrNoUpdateAvailable)
+}
+
+func TestBundleRelease(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	BundlePath = filepath.Join(tmpDir, "bundle")
+
+	key := newTestSigningKey(t)
+
+	// Release manifests don't cover any RELEASE file and list files not needed in a bundle.
+	release := gzipTestFiles(t, map[string][]byte{
+		"IncusOS_202501010000.efi":                 []byte("efi"),
+		"IncusOS_202501010000.usr-x86-64.1234.raw": []byte("usr"),
+		"IncusOS_202501010000.usr-arm64.1234.raw":  []byte("usr"),
+		"IncusOS_202501010000.img":                 []byte("img"),
+		"IncusOS_202501010000.iso":                 []byte("iso"),
+		"incus.raw":                                []byte("incus"),
+		"flasher-tool":                             []byte("flasher"),
+	})
+	sums, signature := signTestManifest(t, key, release)
+
+	bundle := func(names ...string) []byte {
+		files := map[string][]byte{manifestName: sums, manifestSignatureName: signature}
+		for _, name := range names {
+			files[name] = release[name]
+		}
+
+		return tarTestFiles(t, files)
+	}
+
+	// The version comes from the OS files.
+	version, err := ImportBundle(ctx, bytes.NewReader(bundle("IncusOS_202501010000.efi.gz", "IncusOS_202501010000.usr-x86-64.1234.raw.gz", "incus.raw.gz")))
+	require.NoError(t, err)
+	require.Equal(t, "202501010000", version)
+
+	p, err := Load(ctx, nil, "bundle", nil)
+	require.NoError(t, err)
+
+	update, err := p.GetOSUpdate(ctx, "IncusOS", "")
+	require.NoError(t, err)
+	require.Equal(t, "202501010000", update.Version())
+
+	app, err := p.GetApplication(ctx, "incus", "")
+	require.NoError(t, err)
+	require.Equal(t, "202501010000", app.Version())
+
+	// Incomplete OS updates aren't offered.
+	_, err = ImportBundle(ctx, bytes.NewReader(bundle("IncusOS_202501010000.efi.gz", "incus.raw.gz")))
+	require.NoError(t, err)
+
+	_, err = p.GetOSUpdate(ctx, "IncusOS", "")
+	require.ErrorIs(t, err, ErrInvalidBundle)
+
+	// Without any OS file, the version is unknown.
+	_, err = ImportBundle(ctx, bytes.NewReader(bundle("incus.raw.gz")))
+	require.ErrorIs(t, err, ErrInvalidBundle)
+	require.ErrorContains(t, err, "missing RELEASE")
+}
+
+func TestBundleInvalid(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	BundlePath = filepath.Join(tmpDir, "bundle")
+
+	// Files not covered by the manifest are rejected.
+	_, err := ImportBundle(ctx, bytes.NewReader(newTestBundle(t, "202501010000", map[string][]byte{"incus.raw": []byte("incus")}, map[string][]byte{"extra.raw": []byte("extra")})))
+	require.ErrorIs(t, err, ErrInvalidBundle)
+	require.ErrorIs(t, err, ErrNotInManifest)
+
+	// Garbage is rejected.
+	_, err = ImportBundle(ctx, bytes.NewReader([]byte("not a tarball")))
+	require.ErrorIs(t, err, ErrInvalidBundle)
+
+	// Nothing got staged.
+	_, err = os.Stat(BundlePath)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestBundleInUse(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	BundlePath = filepath.Join(tmpDir, "bundle")
+
+	files := map[string][]byte{"incus.raw": []byte("incus")}
+
+	_, err := ImportBundle(ctx, bytes.NewReader(newTestBundle(t, "202501010000", files, nil)))
+	require.NoError(t, err)
+
+	// While applied, the bundle can't be replaced or removed.
+	release, err := AcquireBundle(ctx)
+	require.NoError(t, err)
+
+	_, err = AcquireBundle(ctx)
+	require.ErrorIs(t, err, ErrBundleInUse)
+
+	_, err = ImportBundle(ctx, bytes.NewReader(newTestBundle(t, "202501020000", files, nil)))
+	require.ErrorIs(t, err, ErrBundleInUse)
+
+	require.ErrorIs(t, RemoveBundle(ctx), ErrBundleInUse)
+
+	// Once applied, it gets removed.
+	require.NoError(t, release())
+
+	_, err = os.Stat(BundlePath)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// A bundle staged after the applied one was acquired is kept.
+	release, err = AcquireBundle(ctx)
+	require.NoError(t, err)
+
+	stagedBundle.mu.Lock()
+	stagedBundle.generation++
+	stagedBundle.mu.Unlock()
+
+	require.NoError(t, os.MkdirAll(BundlePath, 0o700))
+	require.NoError(t, release())
+
+	_, err = os.Stat(BundlePath)
+	require.NoError(t, err)
+}
@@ -1,31 +1,44 @@
 package providers
 
 import (
-	"compress/gzip"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	ghapi "github.com/google/go-github/v72/github"
+
+	"github.com/lxc/incus-os/incus-osd/internal/state"
 )
 
+// githubMaxRateLimitWait is the longest we'll wait for a Github rate limit to reset before
+// reporting the provider as unavailable.
+var githubMaxRateLimitWait = time.Minute
+
 // The Github provider.
 type github struct {
+	client       *http.Client
 	gh           *ghapi.Client
 	organization string
 	repository   string
+	channel      string
 
 	config map[string]string
+	state  *state.State
 
 	releaseLastCheck time.Time
 	releaseVersion   string
 	releaseAssets    []*ghapi.ReleaseAsset
+	releaseManifest  manifest
 	releaseMu        sync.Mutex
 }
 
@@ -45,9 +58,13 @@ func (*github) Type() string {
 	return "github"
 }
 
-func (p *github) GetOSUpdate(ctx context.Context, osName string) (OSUpdate, error) {
-	// Get latest release.
-	err := p.checkRelease(ctx)
+func (p *github) Channel() string {
+	return p.channel
+}
+
+func (p *github) GetOSUpdate(ctx context.Context, osName string, version string) (OSUpdate, error) {
+	// Get the release.
+	releaseVersion, releaseAssets, releaseManifest, err := p.getRelease(ctx, version)
 	if err != nil {
 		return nil, err
 	}
@@ -55,8 +72,8 @@ func (p *github) GetOSUpdate(ctx context.Context, osName string) (OSUpdate, erro
 	// Verify the list of returned assets for the OS update contains at least
 	// one file for the release version, otherwise we shouldn't report an OS update.
 	foundUpdateFile := false
-	for _, asset := range p.releaseAssets {
-		if strings.HasPrefix(asset.GetName(), osName+"_") && strings.Contains(asset.GetName(), p.releaseVersion) {
+	for _, asset := range releaseAssets {
+		if strings.HasPrefix(asset.GetName(), osName+"_") && strings.Contains(asset.GetName(), releaseVersion) {
 			foundUpdateFile = true
 
 			break
@@ -70,16 +87,17 @@ func (p *github) GetOSUpdate(ctx context.Context, osName string) (OSUpdate, erro
 	// Prepare the OS update struct.
 	update := githubOSUpdate{
 		provider: p,
-		assets:   p.releaseAssets,
-		version:  p.releaseVersion,
+		assets:   releaseAssets,
+		manifest: releaseManifest,
+		version:  releaseVersion,
 	}
 
 	return &update, nil
 }
 
-func (p *github) GetApplication(ctx context.Context, name string) (Application, error) {
-	// Get latest release.
-	err := p.checkRelease(ctx)
+func (p *github) GetApplication(ctx context.Context, name string, version string) (Application, error) {
+	// Get the release.
+	releaseVersion, releaseAssets, releaseManifest, err := p.getRelease(ctx, version)
 	if err != nil {
 		return nil, err
 	}
@@ -87,8 +105,8 @@ func (p *github) GetApplication(ctx context.Context, name string) (Application,
 	// Verify the list of returned assets contains a "<name>.raw.gz" file, otherwise
 	// we shouldn't return an application update.
 	foundUpdateFile := false
-	for _, asset := range p.releaseAssets {
-		if asset.GetName() == name+".raw.gz" {
+	for _, asset := range releaseAssets {
+		if localAssetName(asset.GetName()) == name+".raw" && strings.HasSuffix(asset.GetName(), ".gz") {
 			foundUpdateFile = true
 
 			break
@@ -103,26 +121,79 @@ func (p *github) GetApplication(ctx context.Context, name string) (Application,
 	app := githubApplication{
 		provider: p,
 		name:     name,
-		assets:   p.releaseAssets,
-		version:  p.releaseVersion,
+		assets:   releaseAssets,
+		manifest: releaseManifest,
+		version:  releaseVersion,
 	}
 
 	return &app, nil
 }
 
 func (p *github) load(_ context.Context) error {
+	// Get the repository to fetch releases from, defaulting to the official one.
+	p.organization = p.config["organization"]
+	if p.organization == "" {
+		p.organization = "lxc"
+	}
+
+	p.repository = p.config["repository"]
+	if p.repository == "" {
+		p.repository = "incus-os"
+	}
+
+	// Setup the HTTP client, shared by the API client and the asset downloads.
+	transport, err := newHTTPTransport(p.state, p.config["ca_certificate"])
+	if err != nil {
+		return err
+	}
+
+	p.client = &http.Client{Transport: transport}
+
 	// Setup the Github client.
-	p.gh = ghapi.NewClient(nil)
+	p.gh = ghapi.NewClient(p.client)
+
+	if p.config["token"] != "" {
+		p.gh = p.gh.WithAuthToken(p.config["token"])
+	}
+
+	if p.config["url"] != "" {
+		p.gh, err = p.gh.WithEnterpriseURLs(p.config["url"], p.config["url"])
+		if err != nil {
+			return fmt.Errorf("invalid Github Enterprise URL %q: %w", p.config["url"], err)
+		}
+	}
 
-	// Fixed configuration for now.
-	p.organization = "lxc"
-	p.repository = "incus-os"
+	// Select the release channel.
+	p.channel = p.config["channel"]
+	if p.channel == "" {
+		p.channel = DefaultChannel
+	}
 
 	return nil
 }
 
-func (*github) checkLimit(err error) error {
-	_, ok := err.(*ghapi.RateLimitError) //nolint:errorlint
+// rateLimitWait returns how long to wait before retrying a request which hit a Github rate limit.
+// The boolean is false if the error isn't rate limit related.
+func (*github) rateLimitWait(err error) (time.Duration, bool) {
+	var rateErr *ghapi.RateLimitError
+	if errors.As(err, &rateErr) {
+		return time.Until(rateErr.Rate.Reset.Time), true
+	}
+
+	var abuseErr *ghapi.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil {
+			return *abuseErr.RetryAfter, true
+		}
+
+		return time.Minute, true
+	}
+
+	return 0, false
+}
+
+func (p *github) checkLimit(err error) error {
+	_, ok := p.rateLimitWait(err)
 	if ok {
 		return ErrProviderUnavailable
 	}
@@ -133,26 +204,71 @@ func (*github) checkLimit(err error) error {
 func (p *github) tryGetRelease(ctx context.Context) (*ghapi.RepositoryRelease, error) {
 	var err error
 
-	for range 5 {
+	for range 3 {
 		var release *ghapi.RepositoryRelease
 
-		release, _, err = p.gh.Repositories.GetLatestRelease(ctx, p.organization, p.repository)
+		release, err = p.getChannelRelease(ctx)
 		if err == nil {
 			return release, nil
 		}
 
-		// Check if dealing with a Github limit error.
-		if !errors.Is(p.checkLimit(err), err) {
+		// Only retry if Github asks us to wait a reasonable amount of time.
+		wait, ok := p.rateLimitWait(err)
+		if !ok || wait > githubMaxRateLimitWait {
 			return nil, err
 		}
 
+		slog.Debug("Waiting for Github rate limit to reset", "wait", wait.Round(time.Second).String())
+
 		// Wait and try again.
-		time.Sleep(time.Second)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
 	}
 
 	return nil, err
 }
 
+func (p *github) getChannelRelease(ctx context.Context) (*ghapi.RepositoryRelease, error) {
+	// The stable channel tracks the latest (non pre-release) release.
+	if p.channel == DefaultChannel {
+		release, _, err := p.gh.Repositories.GetLatestRelease(ctx, p.organization, p.repository)
+
+		return release, err
+	}
+
+	// Get the most recent releases, newest first.
+	releases, _, err := p.gh.Repositories.ListReleases(ctx, p.organization, p.repository, &ghapi.ListOptions{PerPage: 100})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, release := range releases {
+		if release.GetDraft() {
+			continue
+		}
+
+		// The testing channel tracks the newest release, including pre-releases.
+		if p.channel == "testing" {
+			return release, nil
+		}
+
+		// Any other channel is a pattern matched against the release tag.
+		match, err := path.Match(p.channel, release.GetTagName())
+		if err != nil {
+			return nil, fmt.Errorf("invalid channel pattern %q: %w", p.channel, err)
+		}
+
+		if match {
+			return release, nil
+		}
+	}
+
+	return nil, ErrNoUpdateAvailable
+}
+
 func (p *github) checkRelease(ctx context.Context) error {
 	// Acquire lock.
 	p.releaseMu.Lock()
@@ -169,82 +285,152 @@ func (p *github) checkRelease(ctx context.Context) error {
 		return p.checkLimit(err)
 	}
 
-	// Get the list of files for the release.
-	assets, _, err := p.gh.Repositories.ListReleaseAssets(ctx, p.organization, p.repository, release.GetID(), nil)
+	assets, releaseManifest, err := p.getReleaseFiles(ctx, release)
 	if err != nil {
-		return p.checkLimit(err)
+		return err
 	}
 
 	// Record the release.
 	p.releaseLastCheck = time.Now()
 	p.releaseVersion = release.GetName()
 	p.releaseAssets = assets
+	p.releaseManifest = releaseManifest
 
 	return nil
 }
 
-func (p *github) downloadAsset(ctx context.Context, assetID int64, target string, progressFunc func(float64)) error {
-	// Get a reader for the release asset.
-	rc, _, err := p.gh.Repositories.DownloadReleaseAsset(ctx, p.organization, p.repository, assetID, http.DefaultClient)
+// getRelease returns the latest release, or the release with the requested version if one is provided.
+func (p *github) getRelease(ctx context.Context, version string) (string, []*ghapi.ReleaseAsset, manifest, error) {
+	if version == "" {
+		err := p.checkRelease(ctx)
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		return p.releaseVersion, p.releaseAssets, p.releaseManifest, nil
+	}
+
+	// Look for the release by its tag.
+	release, resp, err := p.gh.Repositories.GetReleaseByTag(ctx, p.organization, p.repository, version)
 	if err != nil {
-		return p.checkLimit(err)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", nil, nil, ErrNoUpdateAvailable
+		}
+
+		return "", nil, nil, p.checkLimit(err)
+	}
+
+	assets, releaseManifest, err := p.getReleaseFiles(ctx, release)
+	if err != nil {
+		return "", nil, nil, err
 	}
 
-	defer rc.Close()
+	return release.GetName(), assets, releaseManifest, nil
+}
 
-	// Get the release asset size.
-	ra, _, err := p.gh.Repositories.GetReleaseAsset(ctx, p.organization, p.repository, assetID)
+// getReleaseFiles returns the files of a release along with its signed manifest.
+func (p *github) getReleaseFiles(ctx context.Context, release *ghapi.RepositoryRelease) ([]*ghapi.ReleaseAsset, manifest, error) {
+	// Get the list of files for the release.
+	assets, _, err := p.gh.Repositories.ListReleaseAssets(ctx, p.organization, p.repository, release.GetID(), nil)
 	if err != nil {
-		return p.checkLimit(err)
+		return nil, nil, p.checkLimit(err)
 	}
-	srcSize := float64(*ra.Size)
 
-	// Setup a gzip reader to decompress during streaming.
-	body, err := gzip.NewReader(rc)
+	// Get the signed release manifest.
+	releaseManifest, err := p.getManifest(ctx, assets)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	defer body.Close()
+	// Only keep the files for the local architecture.
+	names := make([]string, 0, len(assets))
+	for _, asset := range assets {
+		names = append(names, asset.GetName())
+	}
 
-	// Create the target path.
-	// #nosec G304
-	fd, err := os.Create(target)
+	keep, err := archAssetFilter(names)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	defer fd.Close()
+	assets = slices.DeleteFunc(assets, func(asset *ghapi.ReleaseAsset) bool {
+		return !keep(asset.GetName())
+	})
 
-	// Read from the decompressor in chunks to avoid excessive memory consumption.
-	count := int64(0)
-	for {
-		_, err = io.CopyN(fd, body, 4*1024*1024)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
+	return assets, releaseManifest, nil
+}
+
+func (p *github) getManifest(ctx context.Context, assets []*ghapi.ReleaseAsset) (manifest, error) {
+	// Fetch the small manifest files into memory.
+	readAsset := func(name string) ([]byte, error) {
+		for _, asset := range assets {
+			if asset.GetName() != name {
+				continue
 			}
 
-			return err
+			rc, _, err := p.gh.Repositories.DownloadReleaseAsset(ctx, p.organization, p.repository, asset.GetID(), p.client)
+			if err != nil {
+				return nil, p.checkLimit(err)
+			}
+
+			defer rc.Close()
+
+			return io.ReadAll(rc)
 		}
 
-		// Update progress every 24MiB.
-		if count%6 == 0 {
-			progressFunc(float64(count*4*1024*1024) / srcSize)
+		return nil, fmt.Errorf("release is missing its %q file", name)
+	}
+
+	body, err := readAsset(manifestName)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := readAsset(manifestSignatureName)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseManifest(body, signature)
+}
+
+// assetSource returns the source of a release asset, only resolving its download URL once actually fetched.
+func (p *github) assetSource(asset *ghapi.ReleaseAsset) assetSource {
+	return func(ctx context.Context, offset int64) (io.ReadCloser, int64, int64, error) {
+		// Resolve the download URL for the release asset.
+		rc, assetURL, err := p.gh.Repositories.DownloadReleaseAsset(ctx, p.organization, p.repository, asset.GetID(), nil)
+		if err != nil {
+			return nil, 0, 0, p.checkLimit(err)
+		}
+
+		// The asset was served directly, so it can't be resumed.
+		if rc != nil {
+			return rc, 0, int64(asset.GetSize()), nil
 		}
-		count++
+
+		// The redirect target is pre-signed, so fetch it without the API credentials.
+		return httpAssetSource(p.client, assetURL)(ctx, offset)
 	}
+}
 
-	return nil
+func (p *github) downloadAsset(ctx context.Context, asset *ghapi.ReleaseAsset, m manifest, target string, progressFunc func(Progress)) error {
+	// Don't share files only available with a token.
+	if p.config["token"] != "" {
+		ctx = withPrivateAssets(ctx)
+	}
+
+	// Download, validate and decompress the asset into place.
+	return fetchAsset(ctx, p.assetSource(asset), asset.GetName(), m, target, true, progressFunc)
 }
 
 // An application from the Github provider.
 type githubApplication struct {
 	provider *github
 
-	assets  []*ghapi.ReleaseAsset
-	name    string
-	version string
+	assets   []*ghapi.ReleaseAsset
+	manifest manifest
+	name     string
+	version  string
 }
 
 func (a *githubApplication) Name() string {
@@ -255,27 +441,20 @@ func (a *githubApplication) Version() string {
 	return a.version
 }
 
-func (a *githubApplication) IsNewerThan(otherVersion string) bool {
-	return datetimeComparison(a.version, otherVersion)
+func (a *githubApplication) IsNewerThan(otherVersion string) (bool, error) {
+	return isNewerVersion(a.version, otherVersion)
 }
 
-func (a *githubApplication) Download(ctx context.Context, target string, progressFunc func(float64)) error {
+func (a *githubApplication) Download(ctx context.Context, target string, progressFunc func(Progress)) error {
 	// Create the target path.
 	err := os.MkdirAll(target, 0o700)
 	if err != nil {
 		return err
 	}
 
-	for _, asset := range a.assets {
-		appName := strings.TrimSuffix(asset.GetName(), ".raw.gz")
-
-		// Only select the desired applications.
-		if appName != a.name {
-			continue
-		}
-
+	for _, asset := range a.selectAssets() {
 		// Download the application.
-		err = a.provider.downloadAsset(ctx, asset.GetID(), filepath.Join(target, strings.TrimSuffix(asset.GetName(), ".gz")), progressFunc)
+		err = a.provider.downloadAsset(ctx, asset, a.manifest, filepath.Join(target, localAssetName(asset.GetName())), progressFunc)
 		if err != nil {
 			return err
 		}
@@ -284,23 +463,49 @@ func (a *githubApplication) Download(ctx context.Context, target string, progres
 	return nil
 }
 
+func (a *githubApplication) DownloadSize(_ context.Context) (int64, error) {
+	total := int64(0)
+	for _, asset := range a.selectAssets() {
+		total += int64(asset.GetSize())
+	}
+
+	return total, nil
+}
+
+// selectAssets returns the release assets making up the application.
+func (a *githubApplication) selectAssets() []*ghapi.ReleaseAsset {
+	assets := []*ghapi.ReleaseAsset{}
+
+	for _, asset := range a.assets {
+		// Only select the desired applications.
+		if localAssetName(asset.GetName()) != a.name+".raw" || !strings.HasSuffix(asset.GetName(), ".gz") {
+			continue
+		}
+
+		assets = append(assets, asset)
+	}
+
+	return assets
+}
+
 // An update from the Github provider.
 type githubOSUpdate struct {
 	provider *github
 
-	assets  []*ghapi.ReleaseAsset
-	version string
+	assets   []*ghapi.ReleaseAsset
+	manifest manifest
+	version  string
 }
 
 func (o *githubOSUpdate) Version() string {
 	return o.version
 }
 
-func (o *githubOSUpdate) IsNewerThan(otherVersion string) bool {
-	return datetimeComparison(o.version, otherVersion)
+func (o *githubOSUpdate) IsNewerThan(otherVersion string) (bool, error) {
+	return isNewerVersion(o.version, otherVersion)
 }
 
-func (o *githubOSUpdate) Download(ctx context.Context, osName string, target string, progressFunc func(float64)) error {
+func (o *githubOSUpdate) Download(ctx context.Context, osName string, target string, progressFunc func(Progress)) error {
 	// Clear the target path.
 	err := os.RemoveAll(target)
 	if err != nil && !os.IsNotExist(err) {
@@ -313,29 +518,65 @@ func (o *githubOSUpdate) Download(ctx context.Context, osName string, target str
 		return err
 	}
 
+	// Deltas are looked up among the release assets.
+	getDelta := func(_ context.Context, name string) (assetSource, error) {
+		for _, asset := range o.assets {
+			if asset.GetName() == name {
+				return o.provider.assetSource(asset), nil
+			}
+		}
+
+		return nil, ErrDeltaUnavailable
+	}
+
+	for _, asset := range o.selectAssets(osName) {
+		// Download the actual update.
+		err = fetchOSAsset(ctx, o.provider.state, o.provider.config, asset.GetName(), o.manifest, filepath.Join(target, localAssetName(asset.GetName())), getDelta, o.provider.assetSource(asset), progressFunc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *githubOSUpdate) DownloadSize(_ context.Context, osName string) (int64, error) {
+	total := int64(0)
+	for _, asset := range o.selectAssets(osName) {
+		total += int64(asset.GetSize())
+	}
+
+	return total, nil
+}
+
+// selectAssets returns the release assets making up the OS update.
+func (o *githubOSUpdate) selectAssets(osName string) []*ghapi.ReleaseAsset {
+	assets := []*ghapi.ReleaseAsset{}
+
 	for _, asset := range o.assets {
 		// Only select OS files.
 		if !strings.HasPrefix(asset.GetName(), osName+"_") {
 			continue
 		}
 
+		// Skip update deltas.
+		if isDeltaAsset(asset.GetName()) {
+			continue
+		}
+
 		// Parse the file names.
-		fields := strings.SplitN(asset.GetName(), ".", 2)
+		fields := strings.SplitN(localAssetName(asset.GetName()), ".", 2)
 		if len(fields) != 2 {
 			continue
 		}
 
 		// Skip the full image.
-		if fields[1] == "img.gz" || fields[1] == "iso.gz" {
+		if fields[1] == "img" || fields[1] == "iso" {
 			continue
 		}
 
-		// Download the actual update.
-		err = o.provider.downloadAsset(ctx, asset.GetID(), filepath.Join(target, strings.TrimSuffix(asset.GetName(), ".gz")), progressFunc)
-		if err != nil {
-			return err
-		}
+		assets = append(assets, asset)
 	}
 
-	return nil
+	return assets
 }
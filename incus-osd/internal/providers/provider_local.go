@@ -3,20 +3,26 @@ package providers
 import (
 	"context"
 	"errors"
-	"io"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+
+	"github.com/lxc/incus-os/incus-osd/internal/state"
 )
 
 // The Local provider.
 type local struct {
-	config map[string]string
-	path   string
-
-	releaseAssets  []string
-	releaseVersion string
+	config  map[string]string
+	state   *state.State
+	path    string
+	channel string
+
+	releaseAssets   []string
+	releaseManifest manifest
+	releaseVersion  string
 }
 
 func (*local) ClearCache(_ context.Context) error {
@@ -33,13 +39,22 @@ func (*local) Type() string {
 	return "local"
 }
 
-func (p *local) GetOSUpdate(ctx context.Context, osName string) (OSUpdate, error) {
+func (p *local) Channel() string {
+	return p.channel
+}
+
+func (p *local) GetOSUpdate(ctx context.Context, osName string, version string) (OSUpdate, error) {
 	// Get latest release.
 	err := p.checkRelease(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	// Only a single release is available.
+	if version != "" && !SameVersion(version, p.releaseVersion) {
+		return nil, ErrNoUpdateAvailable
+	}
+
 	// Verify the list of returned assets for the OS update contains at least
 	// one file for the release version, otherwise we shouldn't report an OS update.
 	foundUpdateFile := false
@@ -59,24 +74,30 @@ func (p *local) GetOSUpdate(ctx context.Context, osName string) (OSUpdate, error
 	update := localOSUpdate{
 		provider: p,
 		assets:   p.releaseAssets,
+		manifest: p.releaseManifest,
 		version:  p.releaseVersion,
 	}
 
 	return &update, nil
 }
 
-func (p *local) GetApplication(ctx context.Context, name string) (Application, error) {
+func (p *local) GetApplication(ctx context.Context, name string, version string) (Application, error) {
 	// Get latest release.
 	err := p.checkRelease(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	// Only a single release is available.
+	if version != "" && !SameVersion(version, p.releaseVersion) {
+		return nil, ErrNoUpdateAvailable
+	}
+
 	// Verify the list of returned assets contains a "<name>.raw" file, otherwise
 	// we shouldn't return an application update.
 	foundUpdateFile := false
 	for _, asset := range p.releaseAssets {
-		if filepath.Base(asset) == name+".raw" {
+		if localAssetName(filepath.Base(asset)) == name+".raw" {
 			foundUpdateFile = true
 
 			break
@@ -92,6 +113,7 @@ func (p *local) GetApplication(ctx context.Context, name string) (Application, e
 		provider: p,
 		name:     name,
 		assets:   p.releaseAssets,
+		manifest: p.releaseManifest,
 		version:  p.releaseVersion,
 	}
 
@@ -102,6 +124,18 @@ func (p *local) load(_ context.Context) error {
 	// Use a hardcoded path for now.
 	p.path = "/root/updates/"
 
+	// Non-default channels are read from a sub-directory.
+	p.channel = p.config["channel"]
+	if p.channel == "" {
+		p.channel = DefaultChannel
+	} else {
+		if p.channel != filepath.Base(p.channel) || p.channel == ".." {
+			return fmt.Errorf("invalid channel %q", p.channel)
+		}
+
+		p.path = filepath.Join(p.path, p.channel)
+	}
+
 	return nil
 }
 
@@ -124,78 +158,71 @@ func (p *local) checkRelease(_ context.Context) error {
 
 	p.releaseVersion = strings.TrimSpace(string(body))
 
-	// Build asset list.
-	assets := []string{}
-
-	entries, err := os.ReadDir(p.path)
+	// Get the signed release manifest.
+	manifestBody, err := os.ReadFile(filepath.Join(p.path, manifestName))
 	if err != nil {
 		return err
 	}
 
-	for _, entry := range entries {
-		assets = append(assets, filepath.Join(p.path, entry.Name()))
+	manifestSignature, err := os.ReadFile(filepath.Join(p.path, manifestSignatureName))
+	if err != nil {
+		return err
 	}
 
-	p.releaseAssets = assets
-
-	return nil
-}
-
-func (p *local) copyAsset(_ context.Context, name string, target string, progressFunc func(float64)) error {
-	// Open the source.
-	// #nosec G304
-	src, err := os.Open(filepath.Join(p.path, name))
+	p.releaseManifest, err = parseManifest(manifestBody, manifestSignature)
 	if err != nil {
 		return err
 	}
 
-	defer src.Close()
+	// Build asset list.
+	assets := []string{}
 
-	// Get the file size.
-	s, err := src.Stat()
+	entries, err := os.ReadDir(p.path)
 	if err != nil {
 		return err
 	}
-	srcSize := float64(s.Size())
 
-	// Open the destination.
-	// #nosec G304
-	dst, err := os.Create(filepath.Join(target, name))
+	for _, entry := range entries {
+		assets = append(assets, filepath.Join(p.path, entry.Name()))
+	}
+
+	// Only keep the files for the local architecture.
+	p.releaseAssets, err = filterArchAssets(assets)
 	if err != nil {
 		return err
 	}
 
-	defer dst.Close()
+	return nil
+}
 
-	// Copy the content.
-	count := int64(0)
-	for {
-		_, err := io.CopyN(dst, src, 4*1024*1024)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
+func (p *local) copyAsset(ctx context.Context, name string, m manifest, target string, progressFunc func(Progress)) error {
+	// Copy and validate the asset into place.
+	return fetchAsset(ctx, fileAssetSource(filepath.Join(p.path, name)), name, m, filepath.Join(target, localAssetName(name)), strings.HasSuffix(name, ".gz"), progressFunc)
+}
 
-			return err
+// assetsSize returns the combined size of the provided files.
+func (p *local) assetsSize(names []string) (int64, error) {
+	total := int64(0)
+	for _, name := range names {
+		size, err := fileAssetSize(filepath.Join(p.path, name))
+		if err != nil {
+			return 0, err
 		}
 
-		// Update progress every 24MiB.
-		if count%6 == 0 {
-			progressFunc(float64(count*4*1024*1024) / srcSize)
-		}
-		count++
+		total += size
 	}
 
-	return nil
+	return total, nil
 }
 
 // An application from the Local provider.
 type localApplication struct {
 	provider *local
 
-	assets  []string
-	name    string
-	version string
+	assets   []string
+	manifest manifest
+	name     string
+	version  string
 }
 
 func (a *localApplication) Name() string {
@@ -206,52 +233,68 @@ func (a *localApplication) Version() string {
 	return a.version
 }
 
-func (a *localApplication) IsNewerThan(otherVersion string) bool {
-	return datetimeComparison(a.version, otherVersion)
+func (a *localApplication) IsNewerThan(otherVersion string) (bool, error) {
+	return isNewerVersion(a.version, otherVersion)
 }
 
-func (a *localApplication) Download(ctx context.Context, target string, progressFunc func(float64)) error {
+func (a *localApplication) Download(ctx context.Context, target string, progressFunc func(Progress)) error {
 	// Create the target path.
 	err := os.MkdirAll(target, 0o700)
 	if err != nil {
 		return err
 	}
 
+	for _, asset := range a.selectAssets() {
+		// Copy the application.
+		err = a.provider.copyAsset(ctx, asset, a.manifest, target, progressFunc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *localApplication) DownloadSize(_ context.Context) (int64, error) {
+	return a.provider.assetsSize(a.selectAssets())
+}
+
+// selectAssets returns the names of the files making up the application.
+func (a *localApplication) selectAssets() []string {
+	assets := []string{}
+
 	for _, asset := range a.assets {
-		appName := strings.TrimSuffix(filepath.Base(asset), ".raw")
+		appName := strings.TrimSuffix(localAssetName(filepath.Base(asset)), ".raw")
 
 		// Only select the desired applications.
 		if appName != a.name {
 			continue
 		}
 
-		// Copy the application.
-		err = a.provider.copyAsset(ctx, filepath.Base(asset), target, progressFunc)
-		if err != nil {
-			return err
-		}
+		assets = append(assets, filepath.Base(asset))
 	}
 
-	return nil
+	return assets
 }
 
 // An update from the Local provider.
 type localOSUpdate struct {
 	provider *local
 
-	assets  []string
-	version string
+	assets   []string
+	manifest manifest
+	version  string
 }
 
 func (o *localOSUpdate) Version() string {
 	return o.version
 }
 
-func (o *localOSUpdate) IsNewerThan(otherVersion string) bool {
-	return datetimeComparison(o.version, otherVersion)
+func (o *localOSUpdate) IsNewerThan(otherVersion string) (bool, error) {
+	return isNewerVersion(o.version, otherVersion)
 }
 
-func (o *localOSUpdate) Download(ctx context.Context, osName string, target string, progressFunc func(float64)) error {
+func (o *localOSUpdate) Download(ctx context.Context, osName string, target string, progressFunc func(Progress)) error {
 	// Clear the path.
 	err := os.RemoveAll(target)
 	if err != nil && !os.IsNotExist(err) {
@@ -264,14 +307,47 @@ func (o *localOSUpdate) Download(ctx context.Context, osName string, target stri
 		return err
 	}
 
+	// Deltas are looked up next to the release files.
+	getDelta := func(_ context.Context, name string) (assetSource, error) {
+		if !slices.Contains(o.assets, filepath.Join(o.provider.path, name)) {
+			return nil, ErrDeltaUnavailable
+		}
+
+		return fileAssetSource(filepath.Join(o.provider.path, name)), nil
+	}
+
+	for _, asset := range o.selectAssets(osName) {
+		// Copy the actual update.
+		err = fetchOSAsset(ctx, o.provider.state, o.provider.config, asset, o.manifest, filepath.Join(target, localAssetName(asset)), getDelta, fileAssetSource(filepath.Join(o.provider.path, asset)), progressFunc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *localOSUpdate) DownloadSize(_ context.Context, osName string) (int64, error) {
+	return o.provider.assetsSize(o.selectAssets(osName))
+}
+
+// selectAssets returns the names of the files making up the OS update.
+func (o *localOSUpdate) selectAssets(osName string) []string {
+	assets := []string{}
+
 	for _, asset := range o.assets {
 		// Only select OS files for the expected version.
 		if !strings.HasPrefix(filepath.Base(asset), osName+"_"+o.version) {
 			continue
 		}
 
+		// Skip update deltas.
+		if isDeltaAsset(filepath.Base(asset)) {
+			continue
+		}
+
 		// Parse the file names.
-		fields := strings.SplitN(filepath.Base(asset), ".", 2)
+		fields := strings.SplitN(localAssetName(filepath.Base(asset)), ".", 2)
 		if len(fields) != 2 {
 			continue
 		}
@@ -281,12 +357,8 @@ func (o *localOSUpdate) Download(ctx context.Context, osName string, target stri
 			continue
 		}
 
-		// Download the actual update.
-		err = o.provider.copyAsset(ctx, filepath.Base(asset), target, progressFunc)
-		if err != nil {
-			return err
-		}
+		assets = append(assets, filepath.Base(asset))
 	}
 
-	return nil
+	return assets
 }
@@ -0,0 +1,49 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalCopyAsset(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	StagingPath = filepath.Join(tmpDir, "staging")
+
+	// A release with both compressed and uncompressed files.
+	p := &local{path: filepath.Join(tmpDir, "updates")}
+	require.NoError(t, os.MkdirAll(p.path, 0o700))
+
+	files := gzipTestFiles(t, map[string][]byte{"incus.raw": []byte("incus")})
+	files["debug.raw"] = []byte("debug")
+
+	m := manifest{}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(p.path, name), data, 0o600))
+
+		hash := sha256.Sum256(data)
+		m[name] = hex.EncodeToString(hash[:])
+	}
+
+	// Files are stored uncompressed under their usual name.
+	target := filepath.Join(tmpDir, "target")
+	require.NoError(t, os.MkdirAll(target, 0o700))
+
+	for name := range files {
+		require.NoError(t, p.copyAsset(ctx, name, m, target, func(Progress) {}))
+	}
+
+	data, err := os.ReadFile(filepath.Join(target, "incus.raw"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("incus"), data)
+
+	data, err = os.ReadFile(filepath.Join(target, "debug.raw"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("debug"), data)
+}
@@ -0,0 +1,499 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxc/incus/v6/shared/osarch"
+
+	"github.com/lxc/incus-os/incus-osd/internal/state"
+)
+
+// mirrorIndex is the JSON index published at the root of an update mirror.
+// Updates are expected to be listed newest first.
+type mirrorIndex struct {
+	Format  string         `json:"format"`
+	Updates []mirrorUpdate `json:"updates"`
+}
+
+// mirrorUpdate represents a single release on an update mirror.
+type mirrorUpdate struct {
+	Version     string       `json:"version"`
+	Channel     string       `json:"channel"`
+	PublishedAt time.Time    `json:"published_at"`
+	Files       []mirrorFile `json:"files"`
+}
+
+// mirrorFile represents a single file of a release on an update mirror.
+type mirrorFile struct {
+	Filename     string `json:"filename"`
+	Size         int64  `json:"size"`
+	Sha256       string `json:"sha256"`
+	Component    string `json:"component"`
+	Type         string `json:"type"`
+	Architecture string `json:"architecture"`
+}
+
+// The Mirror provider.
+type mirror struct {
+	config map[string]string
+	state  *state.State
+
+	client *http.Client
+
+	serverURL string
+	channel   string
+
+	releaseLastCheck time.Time
+	releaseVersion   string
+	releaseAssets    []string
+	releaseManifest  manifest
+	releaseMu        sync.Mutex
+}
+
+func (p *mirror) ClearCache(_ context.Context) error {
+	// Reset the last check time.
+	p.releaseLastCheck = time.Time{}
+
+	return nil
+}
+
+func (*mirror) Register(_ context.Context) error {
+	// No registration with the mirror provider.
+	return ErrRegistrationUnsupported
+}
+
+func (*mirror) Type() string {
+	return "mirror"
+}
+
+func (p *mirror) Channel() string {
+	return p.channel
+}
+
+func (p *mirror) GetOSUpdate(ctx context.Context, osName string, version string) (OSUpdate, error) {
+	// Get the release.
+	releaseVersion, releaseAssets, releaseManifest, err := p.getRelease(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the list of returned assets for the OS update contains at least
+	// one file for the release version, otherwise we shouldn't report an OS update.
+	foundUpdateFile := false
+	for _, asset := range releaseAssets {
+		fileName := filepath.Base(asset)
+
+		if strings.HasPrefix(fileName, osName+"_") && strings.Contains(fileName, releaseVersion) {
+			foundUpdateFile = true
+
+			break
+		}
+	}
+
+	if !foundUpdateFile {
+		return nil, ErrNoUpdateAvailable
+	}
+
+	// Prepare the OS update struct.
+	update := mirrorOSUpdate{
+		provider: p,
+		assets:   releaseAssets,
+		manifest: releaseManifest,
+		version:  releaseVersion,
+	}
+
+	return &update, nil
+}
+
+func (p *mirror) GetApplication(ctx context.Context, name string, version string) (Application, error) {
+	// Get the release.
+	releaseVersion, releaseAssets, releaseManifest, err := p.getRelease(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the list of returned assets contains a "<name>.raw" or "<name>.raw.gz" file,
+	// otherwise we shouldn't return an application update.
+	foundUpdateFile := false
+	for _, asset := range releaseAssets {
+		if localAssetName(filepath.Base(asset)) == name+".raw" {
+			foundUpdateFile = true
+
+			break
+		}
+	}
+
+	if !foundUpdateFile {
+		return nil, ErrNoUpdateAvailable
+	}
+
+	// Prepare the application struct.
+	app := mirrorApplication{
+		provider: p,
+		name:     name,
+		assets:   releaseAssets,
+		manifest: releaseManifest,
+		version:  releaseVersion,
+	}
+
+	return &app, nil
+}
+
+func (p *mirror) load(_ context.Context) error {
+	// Set up the configuration.
+	p.serverURL = strings.TrimSuffix(p.config["url"], "/")
+	if p.serverURL == "" {
+		return errors.New("no mirror URL provided")
+	}
+
+	p.channel = p.config["channel"]
+	if p.channel == "" {
+		p.channel = DefaultChannel
+	}
+
+	// Setup the HTTP client.
+	transport, err := newHTTPTransport(p.state, p.config["ca_certificate"])
+	if err != nil {
+		return err
+	}
+
+	p.client = &http.Client{Transport: transport}
+
+	return nil
+}
+
+func (p *mirror) getFile(ctx context.Context, fileURL string) ([]byte, error) {
+	// Prepare the request.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch the file.
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %q: %s", filepath.Base(fileURL), resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func (p *mirror) checkRelease(ctx context.Context) error {
+	// Acquire lock.
+	p.releaseMu.Lock()
+	defer p.releaseMu.Unlock()
+
+	// Only talk to the mirror once an hour.
+	if !p.releaseLastCheck.IsZero() && p.releaseLastCheck.Add(time.Hour).After(time.Now()) {
+		return nil
+	}
+
+	// Get the latest release for our channel.
+	latestUpdate, err := p.findUpdate(ctx, func(entry mirrorUpdate) bool { return entry.Channel == p.channel })
+	if err != nil {
+		return err
+	}
+
+	latestReleaseFiles, releaseManifest, err := p.getReleaseFiles(ctx, latestUpdate)
+	if err != nil {
+		return err
+	}
+
+	// Record the release.
+	p.releaseLastCheck = time.Now()
+	p.releaseVersion = latestUpdate.Version
+	p.releaseAssets = latestReleaseFiles
+	p.releaseManifest = releaseManifest
+
+	return nil
+}
+
+// getRelease returns the latest release, or the release with the requested version if one is provided.
+func (p *mirror) getRelease(ctx context.Context, version string) (string, []string, manifest, error) {
+	if version == "" {
+		err := p.checkRelease(ctx)
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		return p.releaseVersion, p.releaseAssets, p.releaseManifest, nil
+	}
+
+	// Look for the requested version, in any channel.
+	entry, err := p.findUpdate(ctx, func(entry mirrorUpdate) bool { return SameVersion(entry.Version, version) })
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	releaseFiles, releaseManifest, err := p.getReleaseFiles(ctx, entry)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	return entry.Version, releaseFiles, releaseManifest, nil
+}
+
+// findUpdate returns the first (newest) update from the index matching the filter.
+func (p *mirror) findUpdate(ctx context.Context, filter func(entry mirrorUpdate) bool) (*mirrorUpdate, error) {
+	// Get the index.
+	body, err := p.getFile(ctx, p.serverURL+"/index.json")
+	if err != nil {
+		return nil, err
+	}
+
+	index := mirrorIndex{}
+
+	err = json.Unmarshal(body, &index)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirror index: %w", err)
+	}
+
+	for _, entry := range index.Updates {
+		if filter(entry) {
+			return &entry, nil
+		}
+	}
+
+	return nil, ErrNoUpdateAvailable
+}
+
+// getReleaseFiles returns the files of a release for the local architecture along with its signed manifest.
+func (p *mirror) getReleaseFiles(ctx context.Context, entry *mirrorUpdate) ([]string, manifest, error) {
+	// Get local architecture.
+	archName, err := osarch.ArchitectureGetLocal()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Get the signed release manifest.
+	releaseURL := p.serverURL + "/" + entry.Version + "/"
+
+	manifestBody, err := p.getFile(ctx, releaseURL+manifestName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manifestSignature, err := p.getFile(ctx, releaseURL+manifestSignatureName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	releaseManifest, err := parseManifest(manifestBody, manifestSignature)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Build the file list, making sure the index agrees with the signed manifest.
+	releaseFiles := make([]string, 0, len(entry.Files))
+	for _, file := range entry.Files {
+		if file.Architecture != "" && file.Architecture != archName {
+			continue
+		}
+
+		if file.Filename != filepath.Base(file.Filename) {
+			return nil, nil, fmt.Errorf("invalid file name %q in mirror index", file.Filename)
+		}
+
+		if file.Sha256 != "" {
+			expected, err := releaseManifest.checksum(file.Filename)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if !strings.EqualFold(expected, file.Sha256) {
+				return nil, nil, fmt.Errorf("%w for %q between mirror index and release manifest", ErrChecksumMismatch, file.Filename)
+			}
+		}
+
+		releaseFiles = append(releaseFiles, releaseURL+file.Filename)
+	}
+
+	// Files may also carry their architecture in their name.
+	releaseFiles, err = filterArchAssets(releaseFiles)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return releaseFiles, releaseManifest, nil
+}
+
+func (p *mirror) downloadAsset(ctx context.Context, assetURL string, m manifest, target string, progressFunc func(Progress)) error {
+	fileName := filepath.Base(assetURL)
+
+	// Download, validate and (if needed) decompress the asset into place.
+	return fetchAsset(ctx, httpAssetSource(p.client, assetURL), fileName, m, filepath.Join(target, localAssetName(fileName)), strings.HasSuffix(fileName, ".gz"), progressFunc)
+}
+
+// assetsSize returns the combined size of the provided release files, or -1 if unknown.
+func (p *mirror) assetsSize(ctx context.Context, assetURLs []string) (int64, error) {
+	total := int64(0)
+	for _, assetURL := range assetURLs {
+		size, err := httpAssetSize(ctx, p.client, assetURL)
+		if err != nil {
+			return 0, err
+		}
+
+		total = addAssetSize(total, size)
+	}
+
+	return total, nil
+}
+
+// An application from the Mirror provider.
+type mirrorApplication struct {
+	provider *mirror
+
+	assets   []string
+	manifest manifest
+	name     string
+	version  string
+}
+
+func (a *mirrorApplication) Name() string {
+	return a.name
+}
+
+func (a *mirrorApplication) Version() string {
+	return a.version
+}
+
+func (a *mirrorApplication) IsNewerThan(otherVersion string) (bool, error) {
+	return isNewerVersion(a.version, otherVersion)
+}
+
+func (a *mirrorApplication) Download(ctx context.Context, target string, progressFunc func(Progress)) error {
+	// Create the target path.
+	err := os.MkdirAll(target, 0o700)
+	if err != nil {
+		return err
+	}
+
+	for _, asset := range a.selectAssets() {
+		// Download the application.
+		err = a.provider.downloadAsset(ctx, asset, a.manifest, target, progressFunc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *mirrorApplication) DownloadSize(ctx context.Context) (int64, error) {
+	return a.provider.assetsSize(ctx, a.selectAssets())
+}
+
+// selectAssets returns the release files making up the application.
+func (a *mirrorApplication) selectAssets() []string {
+	assets := []string{}
+
+	for _, asset := range a.assets {
+		appName := strings.TrimSuffix(localAssetName(filepath.Base(asset)), ".raw")
+
+		// Only select the desired applications.
+		if appName != a.name {
+			continue
+		}
+
+		assets = append(assets, asset)
+	}
+
+	return assets
+}
+
+// An update from the Mirror provider.
+type mirrorOSUpdate struct {
+	provider *mirror
+
+	assets   []string
+	manifest manifest
+	version  string
+}
+
+func (o *mirrorOSUpdate) Version() string {
+	return o.version
+}
+
+func (o *mirrorOSUpdate) IsNewerThan(otherVersion string) (bool, error) {
+	return isNewerVersion(o.version, otherVersion)
+}
+
+func (o *mirrorOSUpdate) Download(ctx context.Context, osName string, target string, progressFunc func(Progress)) error {
+	// Clear the target path.
+	err := os.RemoveAll(target)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Create the target path.
+	err = os.MkdirAll(target, 0o700)
+	if err != nil {
+		return err
+	}
+
+	for _, asset := range o.selectAssets(osName) {
+		fileName := filepath.Base(asset)
+
+		// Download the actual update.
+		err = fetchOSAsset(ctx, o.provider.state, o.provider.config, fileName, o.manifest, filepath.Join(target, localAssetName(fileName)), httpDeltaSource(o.provider.client, o.assets), httpAssetSource(o.provider.client, asset), progressFunc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *mirrorOSUpdate) DownloadSize(ctx context.Context, osName string) (int64, error) {
+	return o.provider.assetsSize(ctx, o.selectAssets(osName))
+}
+
+// selectAssets returns the release files making up the OS update.
+func (o *mirrorOSUpdate) selectAssets(osName string) []string {
+	assets := []string{}
+
+	for _, asset := range o.assets {
+		fileName := filepath.Base(asset)
+
+		// Only select OS files.
+		if !strings.HasPrefix(fileName, osName+"_") {
+			continue
+		}
+
+		// Skip update deltas.
+		if isDeltaAsset(fileName) {
+			continue
+		}
+
+		// Parse the file names.
+		fields := strings.SplitN(localAssetName(fileName), ".", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		// Skip the full image.
+		if fields[1] == "img" || fields[1] == "iso" {
+			continue
+		}
+
+		assets = append(assets, asset)
+	}
+
+	return assets
+}
@@ -0,0 +1,290 @@
+package providers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lxc/incus/v6/shared/osarch"
+	"github.com/stretchr/testify/require"
+)
+
+// mirrorTestServer is a minimal update mirror serving a single signed release.
+type mirrorTestServer struct {
+	*httptest.Server
+
+	files map[string][]byte
+}
+
+// newTestSigningKey generates a signing key and makes its certificate the trusted update certificate.
+func newTestSigningKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	manifestCertificatePath = filepath.Join(t.TempDir(), "update.crt")
+	err = os.WriteFile(manifestCertificatePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	require.NoError(t, err)
+
+	return key
+}
+
+// gzipTestFiles compresses each file, adding the ".gz" suffix to its name.
+func gzipTestFiles(t *testing.T, content map[string][]byte) map[string][]byte {
+	t.Helper()
+
+	files := make(map[string][]byte, len(content))
+	for name, data := range content {
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+		_, err := gz.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, gz.Close())
+
+		files[name+".gz"] = buf.Bytes()
+	}
+
+	return files
+}
+
+// signTestManifest returns a SHA256SUMS file covering the files along with its signature.
+func signTestManifest(t *testing.T, key *ecdsa.PrivateKey, files map[string][]byte) ([]byte, []byte) {
+	t.Helper()
+
+	sums := &bytes.Buffer{}
+	for name, data := range files {
+		hash := sha256.Sum256(data)
+		_, _ = fmt.Fprintf(sums, "%s  %s\n", hex.EncodeToString(hash[:]), name)
+	}
+
+	digest := sha256.Sum256(sums.Bytes())
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+
+	return sums.Bytes(), signature
+}
+
+func newMirrorTestServer(t *testing.T, version string, content map[string][]byte) *mirrorTestServer {
+	t.Helper()
+
+	key := newTestSigningKey(t)
+
+	// Compress the files and build the manifest and index.
+	archName, err := osarch.ArchitectureGetLocal()
+	require.NoError(t, err)
+
+	srv := &mirrorTestServer{files: map[string][]byte{}}
+	update := mirrorUpdate{Version: version, Channel: DefaultChannel}
+
+	files := gzipTestFiles(t, content)
+	for name, data := range files {
+		hash := sha256.Sum256(data)
+		srv.files[version+"/"+name] = data
+
+		update.Files = append(update.Files, mirrorFile{
+			Filename:     name,
+			Size:         int64(len(data)),
+			Sha256:       hex.EncodeToString(hash[:]),
+			Architecture: archName,
+		})
+	}
+
+	sums, signature := signTestManifest(t, key, files)
+
+	index, err := json.Marshal(mirrorIndex{Format: "1.0", Updates: []mirrorUpdate{update}})
+	require.NoError(t, err)
+
+	srv.files[version+"/"+manifestName] = sums
+	srv.files[version+"/"+manifestSignatureName] = signature
+	srv.files["index.json"] = index
+
+	// Serve the files, with range support.
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := srv.files[r.URL.Path[1:]]
+		if !ok {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestMirrorUpdate(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	StagingPath = filepath.Join(tmpDir, "staging")
+
+	osFiles := map[string][]byte{
+		"IncusOS_202501010000.efi":                   bytes.Repeat([]byte("efi"), 1024),
+		"IncusOS_202501010000.usr-x86-64.abcdef.raw": bytes.Repeat([]byte("usr"), 1024*1024),
+		"incus.raw": bytes.Repeat([]byte("incus"), 1024),
+	}
+
+	srv := newMirrorTestServer(t, "202501010000", osFiles)
+
+	p, err := Load(ctx, nil, "mirror", map[string]string{"url": srv.URL})
+	require.NoError(t, err)
+	require.Equal(t, "mirror", p.Type())
+	require.Equal(t, DefaultChannel, p.Channel())
+
+	// Pre-seed a partial download to exercise resuming.
+	compressedUsr := srv.files["202501010000/IncusOS_202501010000.usr-x86-64.abcdef.raw.gz"]
+	hash := sha256.Sum256(compressedUsr)
+	require.NoError(t, os.MkdirAll(StagingPath, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(StagingPath, hex.EncodeToString(hash[:])+".partial"), compressedUsr[:len(compressedUsr)/2], 0o600))
+
+	// Get and apply the OS update.
+	update, err := p.GetOSUpdate(ctx, "IncusOS", "")
+	require.NoError(t, err)
+	require.Equal(t, "202501010000", update.Version())
+	isNewer, err := update.IsNewerThan("202412310000")
+	require.NoError(t, err)
+	require.True(t, isNewer)
+
+	// The download size covers the compressed update files.
+	size, err := update.DownloadSize(ctx, "IncusOS")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(srv.files["202501010000/IncusOS_202501010000.efi.gz"])+len(compressedUsr)), size)
+
+	updatesPath := filepath.Join(tmpDir, "updates")
+	err = update.Download(ctx, "IncusOS", updatesPath, func(Progress) {})
+	require.NoError(t, err)
+
+	for _, name := range []string{"IncusOS_202501010000.efi", "IncusOS_202501010000.usr-x86-64.abcdef.raw"} {
+		data, err := os.ReadFile(filepath.Join(updatesPath, name))
+		require.NoError(t, err)
+		require.Equal(t, osFiles[name], data)
+	}
+
+	// Get and apply the application update.
+	app, err := p.GetApplication(ctx, "incus", "")
+	require.NoError(t, err)
+	require.Equal(t, "incus", app.Name())
+
+	size, err = app.DownloadSize(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(srv.files["202501010000/incus.raw.gz"])), size)
+
+	extensionsPath := filepath.Join(tmpDir, "extensions")
+	err = app.Download(ctx, extensionsPath, func(Progress) {})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(extensionsPath, "incus.raw"))
+	require.NoError(t, err)
+	require.Equal(t, osFiles["incus.raw"], data)
+
+	// Staging should be empty once everything is in place.
+	entries, err := os.ReadDir(StagingPath)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// Unknown applications aren't offered.
+	_, err = p.GetApplication(ctx, "missing", "")
+	require.ErrorIs(t, err, ErrNoUpdateAvailable)
+
+	// Specific versions can be requested.
+	app, err = p.GetApplication(ctx, "incus", "202501010000")
+	require.NoError(t, err)
+	require.Equal(t, "202501010000", app.Version())
+
+	_, err = p.GetApplication(ctx, "incus", "202401010000")
+	require.ErrorIs(t, err, ErrNoUpdateAvailable)
+}
+
+func TestMirrorTamperedAsset(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	StagingPath = filepath.Join(tmpDir, "staging")
+
+	srv := newMirrorTestServer(t, "202501010000", map[string][]byte{"incus.raw": []byte("incus")})
+
+	// Replace the application with different content after it was signed.
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write([]byte("evil"))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	srv.files["202501010000/incus.raw.gz"] = buf.Bytes()
+
+	p, err := Load(ctx, nil, "mirror", map[string]string{"url": srv.URL})
+	require.NoError(t, err)
+
+	app, err := p.GetApplication(ctx, "incus", "")
+	require.NoError(t, err)
+
+	extensionsPath := filepath.Join(tmpDir, "extensions")
+	err = app.Download(ctx, extensionsPath, func(Progress) {})
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+
+	// Nothing must have been written into place.
+	_, err = os.Stat(filepath.Join(extensionsPath, "incus.raw"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestMirrorRateLimit(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	StagingPath = filepath.Join(tmpDir, "staging")
+
+	DownloadRateLimit = func() int64 { return 32 * 1024 }
+	t.Cleanup(func() { DownloadRateLimit = func() int64 { return 0 } })
+
+	// Random data doesn't compress, so the download is about 64KiB.
+	content := make([]byte, 64*1024)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	srv := newMirrorTestServer(t, "202501010000", map[string][]byte{"incus.raw": content})
+
+	p, err := Load(ctx, nil, "mirror", map[string]string{"url": srv.URL})
+	require.NoError(t, err)
+
+	app, err := p.GetApplication(ctx, "incus", "")
+	require.NoError(t, err)
+
+	// The download is spread over a couple seconds, reporting progress along the way.
+	progress := []Progress{}
+	start := time.Now()
+
+	err = app.Download(ctx, filepath.Join(tmpDir, "extensions"), func(p Progress) { progress = append(progress, p) })
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), time.Second)
+	require.Greater(t, len(progress), 1)
+
+	last := progress[len(progress)-1]
+	require.Equal(t, last.Total, last.Bytes)
+	require.InDelta(t, 1.0, last.Fraction(), 0.0001)
+}
@@ -0,0 +1,896 @@
+package providers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/lxc/incus-os/incus-osd/internal/state"
+)
+
+// ociMaxMetadataSize is the maximum size of manifests and small blobs read into memory.
+var ociMaxMetadataSize int64 = 4 * 1024 * 1024
+
+// ociCosignSignatureAnnotation is the layer annotation holding a cosign signature.
+var ociCosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+// ociCosignPayload is the part of the cosign simple signing payload we care about.
+type ociCosignPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// The OCI registry provider.
+type oci struct {
+	config map[string]string
+	state  *state.State
+
+	client *http.Client
+
+	registryURL string
+	repository  string
+	reference   string
+	channel     string
+	cosignKey   crypto.PublicKey
+
+	releaseLastCheck time.Time
+	releaseVersion   string
+	releaseAssets    map[string]digest.Digest
+	releaseManifest  manifest
+	releaseMu        sync.Mutex
+}
+
+func (p *oci) ClearCache(_ context.Context) error {
+	// Reset the last check time.
+	p.releaseLastCheck = time.Time{}
+
+	return nil
+}
+
+func (*oci) Register(_ context.Context) error {
+	// No registration with the OCI provider.
+	return ErrRegistrationUnsupported
+}
+
+func (*oci) Type() string {
+	return "oci"
+}
+
+func (p *oci) Channel() string {
+	return p.channel
+}
+
+func (p *oci) GetOSUpdate(ctx context.Context, osName string, version string) (OSUpdate, error) {
+	// Get the release.
+	releaseVersion, releaseAssets, releaseManifest, err := p.getRelease(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the list of returned assets for the OS update contains at least
+	// one file for the release version, otherwise we shouldn't report an OS update.
+	foundUpdateFile := false
+	for fileName := range releaseAssets {
+		if strings.HasPrefix(fileName, osName+"_") && strings.Contains(fileName, releaseVersion) {
+			foundUpdateFile = true
+
+			break
+		}
+	}
+
+	if !foundUpdateFile {
+		return nil, ErrNoUpdateAvailable
+	}
+
+	// Prepare the OS update struct.
+	update := ociOSUpdate{
+		provider: p,
+		assets:   releaseAssets,
+		manifest: releaseManifest,
+		version:  releaseVersion,
+	}
+
+	return &update, nil
+}
+
+func (p *oci) GetApplication(ctx context.Context, name string, version string) (Application, error) {
+	// Get the release.
+	releaseVersion, releaseAssets, releaseManifest, err := p.getRelease(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the list of returned assets contains a "<name>.raw" or "<name>.raw.gz" file,
+	// otherwise we shouldn't return an application update.
+	foundUpdateFile := false
+	for fileName := range releaseAssets {
+		if localAssetName(fileName) == name+".raw" {
+			foundUpdateFile = true
+
+			break
+		}
+	}
+
+	if !foundUpdateFile {
+		return nil, ErrNoUpdateAvailable
+	}
+
+	// Prepare the application struct.
+	app := ociApplication{
+		provider: p,
+		name:     name,
+		assets:   releaseAssets,
+		manifest: releaseManifest,
+		version:  releaseVersion,
+	}
+
+	return &app, nil
+}
+
+func (p *oci) load(_ context.Context) error {
+	// Set up the configuration.
+	p.registryURL = strings.TrimSuffix(p.config["registry"], "/")
+	if p.registryURL == "" {
+		return errors.New("no OCI registry provided")
+	}
+
+	if !strings.Contains(p.registryURL, "://") {
+		p.registryURL = "https://" + p.registryURL
+	}
+
+	p.repository = strings.Trim(p.config["repository"], "/")
+	if p.repository == "" {
+		p.repository = "lxc/incus-os"
+	}
+
+	p.channel = p.config["channel"]
+	if p.channel == "" {
+		p.channel = DefaultChannel
+	}
+
+	// Releases are looked up by the channel tag unless a specific tag or digest is requested.
+	p.reference = p.config["reference"]
+	if p.reference == "" {
+		p.reference = p.channel
+	}
+
+	// Load the optional cosign public key.
+	if p.config["cosign_public_key"] != "" {
+		block, _ := pem.Decode([]byte(p.config["cosign_public_key"]))
+		if block == nil {
+			return errors.New("invalid cosign public key")
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse the cosign public key: %w", err)
+		}
+
+		p.cosignKey = key
+	}
+
+	// Setup the HTTP client.
+	transport, err := newHTTPTransport(p.state, p.config["ca_certificate"])
+	if err != nil {
+		return err
+	}
+
+	registryURL, err := url.Parse(p.registryURL)
+	if err != nil {
+		return err
+	}
+
+	p.client = &http.Client{
+		Transport: &ociTransport{
+			base:     transport,
+			host:     registryURL.Host,
+			username: p.config["username"],
+			password: p.config["password"],
+		},
+	}
+
+	return nil
+}
+
+// get performs a GET request against the registry API.
+func (p *oci) get(ctx context.Context, path string, accept []string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.registryURL+"/v2/"+p.repository+"/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(accept) > 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrNoUpdateAvailable
+		}
+
+		return nil, fmt.Errorf("failed to fetch %q: %s", path, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// getManifest resolves a tag or digest and returns the manifest content and digest.
+func (p *oci) getManifest(ctx context.Context, reference string) ([]byte, string, digest.Digest, error) {
+	resp, err := p.get(ctx, "manifests/"+reference, []string{ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageIndex})
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, ociMaxMetadataSize))
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	dgst := digest.FromBytes(body)
+
+	// When resolving a digest, the content must match it.
+	expected, err := digest.Parse(reference)
+	if err == nil && expected != dgst {
+		return nil, "", "", fmt.Errorf("%w for manifest %q (got %s)", ErrChecksumMismatch, reference, dgst)
+	}
+
+	// When resolving a tag, the content must match what the registry advertised.
+	header, err := digest.Parse(resp.Header.Get("Docker-Content-Digest"))
+	if err == nil && header.Algorithm() == dgst.Algorithm() && header != dgst {
+		return nil, "", "", fmt.Errorf("%w for manifest %q (expected %s, got %s)", ErrChecksumMismatch, reference, header, dgst)
+	}
+
+	// Figure out the media type.
+	mediaType := struct {
+		MediaType string `json:"mediaType"`
+	}{}
+
+	err = json.Unmarshal(body, &mediaType)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("invalid manifest %q: %w", reference, err)
+	}
+
+	if mediaType.MediaType == "" {
+		mediaType.MediaType, _, _ = strings.Cut(resp.Header.Get("Content-Type"), ";")
+	}
+
+	return body, mediaType.MediaType, dgst, nil
+}
+
+// getBlob fetches a small blob into memory, validating its digest.
+func (p *oci) getBlob(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	err := dgst.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.get(ctx, "blobs/"+dgst.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, ociMaxMetadataSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if digest.FromBytes(body) != dgst {
+		return nil, fmt.Errorf("%w for blob %q", ErrChecksumMismatch, dgst)
+	}
+
+	return body, nil
+}
+
+// verifySignature checks that a cosign signature from the configured key covers the manifest.
+func (p *oci) verifySignature(ctx context.Context, dgst digest.Digest) error {
+	// Cosign stores signatures under a tag derived from the manifest digest.
+	body, _, _, err := p.getManifest(ctx, dgst.Algorithm().String()+"-"+dgst.Encoded()+".sig")
+	if err != nil {
+		if errors.Is(err, ErrNoUpdateAvailable) {
+			return fmt.Errorf("%w: no signature found for %q", ErrInvalidSignature, dgst)
+		}
+
+		return err
+	}
+
+	sigManifest := ocispec.Manifest{}
+
+	err = json.Unmarshal(body, &sigManifest)
+	if err != nil {
+		return err
+	}
+
+	for _, layer := range sigManifest.Layers {
+		signature, err := base64.StdEncoding.DecodeString(layer.Annotations[ociCosignSignatureAnnotation])
+		if err != nil || len(signature) == 0 {
+			continue
+		}
+
+		payload, err := p.getBlob(ctx, layer.Digest)
+		if err != nil {
+			return err
+		}
+
+		if !verifyPublicKeySignature(p.cosignKey, payload, signature) {
+			continue
+		}
+
+		content := ociCosignPayload{}
+
+		err = json.Unmarshal(payload, &content)
+		if err != nil {
+			continue
+		}
+
+		if content.Critical.Image.DockerManifestDigest == dgst.String() {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: no valid signature found for %q", ErrInvalidSignature, dgst)
+}
+
+func (p *oci) checkRelease(ctx context.Context) error {
+	// Acquire lock.
+	p.releaseMu.Lock()
+	defer p.releaseMu.Unlock()
+
+	// Only talk to the registry once an hour.
+	if !p.releaseLastCheck.IsZero() && p.releaseLastCheck.Add(time.Hour).After(time.Now()) {
+		return nil
+	}
+
+	version, files, releaseManifest, err := p.resolveRelease(ctx, p.reference)
+	if err != nil {
+		return err
+	}
+
+	// Record the release.
+	p.releaseLastCheck = time.Now()
+	p.releaseVersion = version
+	p.releaseAssets = files
+	p.releaseManifest = releaseManifest
+
+	return nil
+}
+
+// getRelease returns the latest release, or the release with the requested version if one is provided.
+// Specific versions are expected to be tagged with their version string.
+func (p *oci) getRelease(ctx context.Context, version string) (string, map[string]digest.Digest, manifest, error) {
+	if version == "" {
+		err := p.checkRelease(ctx)
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		return p.releaseVersion, p.releaseAssets, p.releaseManifest, nil
+	}
+
+	releaseVersion, files, releaseManifest, err := p.resolveRelease(ctx, version)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	if !SameVersion(releaseVersion, version) {
+		return "", nil, nil, fmt.Errorf("tag %q holds version %q", version, releaseVersion)
+	}
+
+	return releaseVersion, files, releaseManifest, nil
+}
+
+// resolveRelease resolves a tag or digest into a validated release.
+func (p *oci) resolveRelease(ctx context.Context, reference string) (string, map[string]digest.Digest, manifest, error) {
+	// Resolve the reference.
+	body, mediaType, dgst, err := p.getManifest(ctx, reference)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	// Pick the manifest for our architecture out of multi-architecture images.
+	if mediaType == ocispec.MediaTypeImageIndex {
+		index := ocispec.Index{}
+
+		err = json.Unmarshal(body, &index)
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		var found *ocispec.Descriptor
+
+		for _, entry := range index.Manifests {
+			if entry.Platform == nil || (entry.Platform.OS == "linux" && entry.Platform.Architecture == runtime.GOARCH) {
+				found = &entry
+
+				break
+			}
+		}
+
+		if found == nil {
+			return "", nil, nil, ErrNoUpdateAvailable
+		}
+
+		body, _, dgst, err = p.getManifest(ctx, found.Digest.String())
+		if err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	// Validate the signature if required.
+	if p.cosignKey != nil {
+		err = p.verifySignature(ctx, dgst)
+		if err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	releaseImage := ocispec.Manifest{}
+
+	err = json.Unmarshal(body, &releaseImage)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	version := releaseImage.Annotations[ocispec.AnnotationVersion]
+	if version == "" {
+		return "", nil, nil, fmt.Errorf("missing %q annotation on %q", ocispec.AnnotationVersion, reference)
+	}
+
+	// List the files, named after their title annotation.
+	files := map[string]digest.Digest{}
+	for _, layer := range releaseImage.Layers {
+		fileName := layer.Annotations[ocispec.AnnotationTitle]
+		if fileName == "" {
+			continue
+		}
+
+		if fileName != filepath.Base(fileName) {
+			return "", nil, nil, fmt.Errorf("invalid file name %q in OCI manifest", fileName)
+		}
+
+		files[fileName] = layer.Digest
+	}
+
+	// Get the signed release manifest.
+	if files[manifestName] == "" || files[manifestSignatureName] == "" {
+		return "", nil, nil, fmt.Errorf("%w: %q", ErrNotInManifest, manifestName)
+	}
+
+	manifestBody, err := p.getBlob(ctx, files[manifestName])
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	manifestSignature, err := p.getBlob(ctx, files[manifestSignatureName])
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	releaseManifest, err := parseManifest(manifestBody, manifestSignature)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	delete(files, manifestName)
+	delete(files, manifestSignatureName)
+
+	// Make sure the blob digests agree with the signed manifest.
+	for fileName, fileDigest := range files {
+		expected, err := releaseManifest.checksum(fileName)
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		if fileDigest.Algorithm() != digest.SHA256 || fileDigest.Encoded() != expected {
+			return "", nil, nil, fmt.Errorf("%w for %q between OCI manifest and release manifest", ErrChecksumMismatch, fileName)
+		}
+	}
+
+	// Only keep the files for the local architecture.
+	keep, err := archAssetFilter(slices.Collect(maps.Keys(files)))
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	maps.DeleteFunc(files, func(fileName string, _ digest.Digest) bool {
+		return !keep(fileName)
+	})
+
+	return version, files, releaseManifest, nil
+}
+
+// blobURL returns the registry URL of a release blob.
+func (p *oci) blobURL(dgst digest.Digest) string {
+	return p.registryURL + "/v2/" + p.repository + "/blobs/" + dgst.String()
+}
+
+// assetsSize returns the combined size of the provided release blobs, or -1 if unknown.
+func (p *oci) assetsSize(ctx context.Context, assets map[string]digest.Digest) (int64, error) {
+	total := int64(0)
+	for _, dgst := range assets {
+		size, err := httpAssetSize(ctx, p.client, p.blobURL(dgst))
+		if err != nil {
+			return 0, err
+		}
+
+		total = addAssetSize(total, size)
+	}
+
+	return total, nil
+}
+
+func (p *oci) downloadAsset(ctx context.Context, fileName string, dgst digest.Digest, m manifest, target string, progressFunc func(Progress)) error {
+	blobURL := p.blobURL(dgst)
+
+	// Don't share files only available with the registry credentials.
+	if p.config["username"] != "" {
+		ctx = withPrivateAssets(ctx)
+	}
+
+	// Download, validate and (if needed) decompress the blob into place.
+	return fetchAsset(ctx, httpAssetSource(p.client, blobURL), fileName, m, filepath.Join(target, localAssetName(fileName)), strings.HasSuffix(fileName, ".gz"), progressFunc)
+}
+
+// An application from the OCI provider.
+type ociApplication struct {
+	provider *oci
+
+	assets   map[string]digest.Digest
+	manifest manifest
+	name     string
+	version  string
+}
+
+func (a *ociApplication) Name() string {
+	return a.name
+}
+
+func (a *ociApplication) Version() string {
+	return a.version
+}
+
+func (a *ociApplication) IsNewerThan(otherVersion string) (bool, error) {
+	return isNewerVersion(a.version, otherVersion)
+}
+
+func (a *ociApplication) Download(ctx context.Context, target string, progressFunc func(Progress)) error {
+	// Create the target path.
+	err := os.MkdirAll(target, 0o700)
+	if err != nil {
+		return err
+	}
+
+	for fileName, dgst := range a.selectAssets() {
+		// Download the application.
+		err = a.provider.downloadAsset(ctx, fileName, dgst, a.manifest, target, progressFunc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *ociApplication) DownloadSize(ctx context.Context) (int64, error) {
+	return a.provider.assetsSize(ctx, a.selectAssets())
+}
+
+// selectAssets returns the release files making up the application.
+func (a *ociApplication) selectAssets() map[string]digest.Digest {
+	assets := map[string]digest.Digest{}
+
+	for fileName, dgst := range a.assets {
+		appName := strings.TrimSuffix(localAssetName(fileName), ".raw")
+
+		// Only select the desired applications.
+		if appName != a.name {
+			continue
+		}
+
+		assets[fileName] = dgst
+	}
+
+	return assets
+}
+
+// An update from the OCI provider.
+type ociOSUpdate struct {
+	provider *oci
+
+	assets   map[string]digest.Digest
+	manifest manifest
+	version  string
+}
+
+func (o *ociOSUpdate) Version() string {
+	return o.version
+}
+
+func (o *ociOSUpdate) IsNewerThan(otherVersion string) (bool, error) {
+	return isNewerVersion(o.version, otherVersion)
+}
+
+func (o *ociOSUpdate) Download(ctx context.Context, osName string, target string, progressFunc func(Progress)) error {
+	// Clear the target path.
+	err := os.RemoveAll(target)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Create the target path.
+	err = os.MkdirAll(target, 0o700)
+	if err != nil {
+		return err
+	}
+
+	// Deltas are looked up among the release blobs.
+	getDelta := func(_ context.Context, name string) (assetSource, error) {
+		dgst, ok := o.assets[name]
+		if !ok {
+			return nil, ErrDeltaUnavailable
+		}
+
+		return httpAssetSource(o.provider.client, o.provider.blobURL(dgst)), nil
+	}
+
+	for fileName, dgst := range o.selectAssets(osName) {
+		// Download the actual update.
+		err = fetchOSAsset(ctx, o.provider.state, o.provider.config, fileName, o.manifest, filepath.Join(target, localAssetName(fileName)), getDelta, httpAssetSource(o.provider.client, o.provider.blobURL(dgst)), progressFunc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *ociOSUpdate) DownloadSize(ctx context.Context, osName string) (int64, error) {
+	return o.provider.assetsSize(ctx, o.selectAssets(osName))
+}
+
+// selectAssets returns the release files making up the OS update.
+func (o *ociOSUpdate) selectAssets(osName string) map[string]digest.Digest {
+	assets := map[string]digest.Digest{}
+
+	for fileName, dgst := range o.assets {
+		// Only select OS files.
+		if !strings.HasPrefix(fileName, osName+"_") {
+			continue
+		}
+
+		// Skip update deltas.
+		if isDeltaAsset(fileName) {
+			continue
+		}
+
+		// Parse the file names.
+		fields := strings.SplitN(localAssetName(fileName), ".", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		// Skip the full image.
+		if fields[1] == "img" || fields[1] == "iso" {
+			continue
+		}
+
+		assets[fileName] = dgst
+	}
+
+	return assets
+}
+
+// ociTransport handles the registry authentication, supporting both basic and bearer token challenges.
+type ociTransport struct {
+	base http.RoundTripper
+	host string
+
+	username string
+	password string
+
+	authorization   string
+	authorizationMu sync.Mutex
+}
+
+func (t *ociTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Credentials are only ever sent to the registry itself, not to the storage it may redirect to.
+	if req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
+
+	t.authorizationMu.Lock()
+	authorization := t.authorization
+	t.authorizationMu.Unlock()
+
+	resp, err := t.do(req, authorization)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// Answer the authentication challenge.
+	challenge := resp.Header.Get("WWW-Authenticate")
+	_ = resp.Body.Close()
+
+	authorization, err = t.authenticate(req.Context(), challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	t.authorizationMu.Lock()
+	t.authorization = authorization
+	t.authorizationMu.Unlock()
+
+	return t.do(req, authorization)
+}
+
+func (t *ociTransport) do(req *http.Request, authorization string) (*http.Response, error) {
+	if authorization == "" {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", authorization)
+
+	return t.base.RoundTrip(req)
+}
+
+func (t *ociTransport) authenticate(ctx context.Context, challenge string) (string, error) {
+	scheme, params := parseAuthChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if t.username == "" {
+			return "", errors.New("OCI registry requires credentials")
+		}
+
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(t.username+":"+t.password)), nil
+
+	case "bearer":
+		if params["realm"] == "" {
+			return "", errors.New("OCI registry didn't provide a token realm")
+		}
+
+		// Request a token.
+		tokenURL, err := url.Parse(params["realm"])
+		if err != nil {
+			return "", err
+		}
+
+		query := tokenURL.Query()
+		for _, key := range []string{"service", "scope"} {
+			if params[key] != "" {
+				query.Set(key, params[key])
+			}
+		}
+
+		tokenURL.RawQuery = query.Encode()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+		if err != nil {
+			return "", err
+		}
+
+		if t.username != "" {
+			req.SetBasicAuth(t.username, t.password)
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("failed to get an OCI registry token: %s", resp.Status)
+		}
+
+		token := struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}{}
+
+		err = json.NewDecoder(io.LimitReader(resp.Body, ociMaxMetadataSize)).Decode(&token)
+		if err != nil {
+			return "", err
+		}
+
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+
+		if token.Token == "" {
+			return "", errors.New("OCI registry returned an empty token")
+		}
+
+		return "Bearer " + token.Token, nil
+	}
+
+	return "", fmt.Errorf("unsupported OCI registry authentication %q", scheme)
+}
+
+// parseAuthChallenge parses a WWW-Authenticate header into its scheme and parameters.
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := map[string]string{}
+
+	for rest != "" {
+		// Get the key.
+		var key string
+
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		// Get the value, which may be quoted and contain commas.
+		var value string
+
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+
+		if key != "" {
+			params[key] = strings.TrimSpace(value)
+		}
+	}
+
+	return scheme, params
+}
+
+// verifyPublicKeySignature checks a signature over the SHA256 digest of the payload.
+func verifyPublicKeySignature(key crypto.PublicKey, payload []byte, signature []byte) bool {
+	hash := sha256.Sum256(payload)
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, hash[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, signature)
+	}
+
+	return false
+}
@@ -0,0 +1,250 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// newOCITestServer returns a minimal token authenticated registry serving a single signed release.
+func newOCITestServer(t *testing.T, version string, content map[string][]byte, cosignKey *ecdsa.PrivateKey) *httptest.Server {
+	t.Helper()
+
+	key := newTestSigningKey(t)
+
+	manifests := map[string][]byte{}
+	blobs := map[digest.Digest][]byte{}
+
+	addBlob := func(data []byte, annotations map[string]string) ocispec.Descriptor {
+		dgst := digest.FromBytes(data)
+		blobs[dgst] = data
+
+		return ocispec.Descriptor{MediaType: "application/octet-stream", Digest: dgst, Size: int64(len(data)), Annotations: annotations}
+	}
+
+	addManifest := func(m ocispec.Manifest) digest.Digest {
+		m.SchemaVersion = 2
+		m.MediaType = ocispec.MediaTypeImageManifest
+		m.Config = addBlob([]byte("{}"), nil)
+
+		body, err := json.Marshal(m)
+		require.NoError(t, err)
+
+		dgst := digest.FromBytes(body)
+		manifests[dgst.String()] = body
+
+		return dgst
+	}
+
+	// Build the release.
+	files := gzipTestFiles(t, content)
+	sums, signature := signTestManifest(t, key, files)
+	files[manifestName] = sums
+	files[manifestSignatureName] = signature
+
+	release := ocispec.Manifest{Annotations: map[string]string{ocispec.AnnotationVersion: version}}
+	for name, data := range files {
+		release.Layers = append(release.Layers, addBlob(data, map[string]string{ocispec.AnnotationTitle: name}))
+	}
+
+	releaseDigest := addManifest(release)
+	manifests[DefaultChannel] = manifests[releaseDigest.String()]
+
+	// Sign the release.
+	payload := []byte(`{"critical":{"image":{"docker-manifest-digest":"` + releaseDigest.String() + `"}}}`)
+	payloadHash := sha256.Sum256(payload)
+	payloadSignature, err := ecdsa.SignASN1(rand.Reader, cosignKey, payloadHash[:])
+	require.NoError(t, err)
+
+	sigDigest := addManifest(ocispec.Manifest{Layers: []ocispec.Descriptor{
+		addBlob(payload, map[string]string{ociCosignSignatureAnnotation: base64.StdEncoding.EncodeToString(payloadSignature)}),
+	}})
+
+	manifests["sha256-"+releaseDigest.Encoded()+".sig"] = manifests[sigDigest.String()]
+
+	// Serve the registry API.
+	var srv *httptest.Server
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			username, password, _ := r.BasicAuth()
+			if username != "user" || password != "pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"token": "secret"}`))
+
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test",scope="repository:incus-os:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		ref, ok := strings.CutPrefix(r.URL.Path, "/v2/incus-os/manifests/")
+		if ok {
+			body, ok := manifests[ref]
+			if !ok {
+				http.NotFound(w, r)
+
+				return
+			}
+
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(body).String())
+			_, _ = w.Write(body)
+
+			return
+		}
+
+		ref, ok = strings.CutPrefix(r.URL.Path, "/v2/incus-os/blobs/")
+		if ok {
+			data, ok := blobs[digest.Digest(ref)]
+			if !ok {
+				http.NotFound(w, r)
+
+				return
+			}
+
+			http.ServeContent(w, r, ref, time.Time{}, bytes.NewReader(data))
+
+			return
+		}
+
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func encodeTestPublicKey(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestOCIUpdate(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	StagingPath = filepath.Join(tmpDir, "staging")
+
+	cosignKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	osFiles := map[string][]byte{
+		"IncusOS_202501010000.efi":                   bytes.Repeat([]byte("efi"), 1024),
+		"IncusOS_202501010000.usr-x86-64.abcdef.raw": bytes.Repeat([]byte("usr"), 1024),
+		"incus.raw": bytes.Repeat([]byte("incus"), 1024),
+	}
+
+	srv := newOCITestServer(t, "202501010000", osFiles, cosignKey)
+
+	p, err := Load(ctx, nil, "oci", map[string]string{
+		"registry":          srv.URL,
+		"repository":        "incus-os",
+		"username":          "user",
+		"password":          "pass",
+		"cosign_public_key": encodeTestPublicKey(t, cosignKey),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "oci", p.Type())
+
+	// Get and apply the OS update.
+	update, err := p.GetOSUpdate(ctx, "IncusOS", "")
+	require.NoError(t, err)
+	require.Equal(t, "202501010000", update.Version())
+
+	size, err := update.DownloadSize(ctx, "IncusOS")
+	require.NoError(t, err)
+	require.Positive(t, size)
+
+	updatesPath := filepath.Join(tmpDir, "updates")
+	err = update.Download(ctx, "IncusOS", updatesPath, func(Progress) {})
+	require.NoError(t, err)
+
+	for _, name := range []string{"IncusOS_202501010000.efi", "IncusOS_202501010000.usr-x86-64.abcdef.raw"} {
+		data, err := os.ReadFile(filepath.Join(updatesPath, name))
+		require.NoError(t, err)
+		require.Equal(t, osFiles[name], data)
+	}
+
+	// Get and apply the application update.
+	app, err := p.GetApplication(ctx, "incus", "")
+	require.NoError(t, err)
+
+	size, err = app.DownloadSize(ctx)
+	require.NoError(t, err)
+	require.Positive(t, size)
+
+	extensionsPath := filepath.Join(tmpDir, "extensions")
+	err = app.Download(ctx, extensionsPath, func(Progress) {})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(extensionsPath, "incus.raw"))
+	require.NoError(t, err)
+	require.Equal(t, osFiles["incus.raw"], data)
+}
+
+func TestOCIInvalidSignature(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	StagingPath = filepath.Join(t.TempDir(), "staging")
+
+	cosignKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	srv := newOCITestServer(t, "202501010000", map[string][]byte{"incus.raw": []byte("incus")}, cosignKey)
+
+	p, err := Load(ctx, nil, "oci", map[string]string{
+		"registry":          srv.URL,
+		"repository":        "incus-os",
+		"username":          "user",
+		"password":          "pass",
+		"cosign_public_key": encodeTestPublicKey(t, otherKey),
+	})
+	require.NoError(t, err)
+
+	_, err = p.GetApplication(ctx, "incus", "")
+	require.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestParseAuthChallenge(t *testing.T) {
+	t.Parallel()
+
+	scheme, params := parseAuthChallenge(`Bearer realm="https://auth.example.com/token",service="registry",scope="repository:a/b:pull,push"`)
+	require.Equal(t, "Bearer", scheme)
+	require.Equal(t, map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry",
+		"scope":   "repository:a/b:pull,push",
+	}, params)
+}
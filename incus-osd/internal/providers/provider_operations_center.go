@@ -2,11 +2,11 @@ package providers
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -19,20 +19,25 @@ import (
 	incusclient "github.com/lxc/incus/v6/client"
 	"github.com/lxc/incus/v6/shared/api"
 	"github.com/lxc/incus/v6/shared/osarch"
+
+	"github.com/lxc/incus-os/incus-osd/internal/state"
 )
 
 // The Operations Center provider.
 type operationsCenter struct {
 	config map[string]string
+	state  *state.State
 
 	client *http.Client
 
 	serverURL   string
 	serverToken string
+	channel     string
 
 	releaseLastCheck time.Time
 	releaseVersion   string
 	releaseAssets    []string
+	releaseManifest  manifest
 	releaseMu        sync.Mutex
 }
 
@@ -108,9 +113,13 @@ func (*operationsCenter) Type() string {
 	return "operations-center"
 }
 
-func (p *operationsCenter) GetOSUpdate(ctx context.Context, osName string) (OSUpdate, error) {
-	// Get latest release.
-	err := p.checkRelease(ctx)
+func (p *operationsCenter) Channel() string {
+	return p.channel
+}
+
+func (p *operationsCenter) GetOSUpdate(ctx context.Context, osName string, version string) (OSUpdate, error) {
+	// Get the release.
+	releaseVersion, releaseAssets, releaseManifest, err := p.getRelease(ctx, version)
 	if err != nil {
 		return nil, err
 	}
@@ -118,10 +127,10 @@ func (p *operationsCenter) GetOSUpdate(ctx context.Context, osName string) (OSUp
 	// Verify the list of returned assets for the OS update contains at least
 	// one file for the release version, otherwise we shouldn't report an OS update.
 	foundUpdateFile := false
-	for _, asset := range p.releaseAssets {
+	for _, asset := range releaseAssets {
 		fileName := filepath.Base(asset)
 
-		if strings.HasPrefix(fileName, osName+"_") && strings.Contains(fileName, p.releaseVersion) {
+		if strings.HasPrefix(fileName, osName+"_") && strings.Contains(fileName, releaseVersion) {
 			foundUpdateFile = true
 
 			break
@@ -135,16 +144,17 @@ func (p *operationsCenter) GetOSUpdate(ctx context.Context, osName string) (OSUp
 	// Prepare the OS update struct.
 	update := operationsCenterOSUpdate{
 		provider: p,
-		assets:   p.releaseAssets,
-		version:  p.releaseVersion,
+		assets:   releaseAssets,
+		manifest: releaseManifest,
+		version:  releaseVersion,
 	}
 
 	return &update, nil
 }
 
-func (p *operationsCenter) GetApplication(ctx context.Context, name string) (Application, error) {
-	// Get latest release.
-	err := p.checkRelease(ctx)
+func (p *operationsCenter) GetApplication(ctx context.Context, name string, version string) (Application, error) {
+	// Get the release.
+	releaseVersion, releaseAssets, releaseManifest, err := p.getRelease(ctx, version)
 	if err != nil {
 		return nil, err
 	}
@@ -152,10 +162,10 @@ func (p *operationsCenter) GetApplication(ctx context.Context, name string) (App
 	// Verify the list of returned assets contains a "<name>.raw.gz" file, otherwise
 	// we shouldn't return an application update.
 	foundUpdateFile := false
-	for _, asset := range p.releaseAssets {
+	for _, asset := range releaseAssets {
 		fileName := filepath.Base(asset)
 
-		if fileName == name+".raw.gz" {
+		if localAssetName(fileName) == name+".raw" && strings.HasSuffix(fileName, ".gz") {
 			foundUpdateFile = true
 
 			break
@@ -170,8 +180,9 @@ func (p *operationsCenter) GetApplication(ctx context.Context, name string) (App
 	app := operationsCenterApplication{
 		provider: p,
 		name:     name,
-		assets:   p.releaseAssets,
-		version:  p.releaseVersion,
+		assets:   releaseAssets,
+		manifest: releaseManifest,
+		version:  releaseVersion,
 	}
 
 	return &app, nil
@@ -184,6 +195,11 @@ func (p *operationsCenter) load(_ context.Context) error {
 	p.serverURL = p.config["server_url"]
 	p.serverToken = p.config["server_token"]
 
+	p.channel = p.config["channel"]
+	if p.channel == "" {
+		p.channel = DefaultChannel
+	}
+
 	// Basic validation.
 	if p.serverURL == "" {
 		return errors.New("no operations center URL provided")
@@ -314,155 +330,212 @@ func (p *operationsCenter) apiRequest(ctx context.Context, method string, path s
 	return apiResp, nil
 }
 
+// operationsCenterUpdate is an update as listed by Operations Center.
+type operationsCenterUpdate struct {
+	Channel string `json:"channel"`
+	UUID    string `json:"uuid"`
+	Version string `json:"version"`
+}
+
+// operationsCenterUpdateFile is a file of an update as listed by Operations Center.
+type operationsCenterUpdateFile struct {
+	Filename     string `json:"filename"`
+	Size         int64  `json:"size"`
+	Component    string `json:"component"`
+	Type         string `json:"type"`
+	Architecture string `json:"architecture"`
+}
+
 func (p *operationsCenter) checkRelease(ctx context.Context) error {
 	// Acquire lock.
 	p.releaseMu.Lock()
 	defer p.releaseMu.Unlock()
 
-	// Get local architecture.
-	archName, err := osarch.ArchitectureGetLocal()
+	// Only talk to Operations Center once an hour.
+	if !p.releaseLastCheck.IsZero() && p.releaseLastCheck.Add(time.Hour).After(time.Now()) {
+		return nil
+	}
+
+	// Get the latest release for our channel.
+	latestUpdate, err := p.findUpdate(ctx, func(entry operationsCenterUpdate) bool { return entry.Channel == p.channel })
 	if err != nil {
 		return err
 	}
 
-	// Only talk to Operations Center once an hour.
-	if !p.releaseLastCheck.IsZero() && p.releaseLastCheck.Add(time.Hour).After(time.Now()) {
-		return nil
+	latestReleaseFiles, releaseManifest, err := p.getReleaseFiles(ctx, latestUpdate)
+	if err != nil {
+		return err
 	}
 
-	// API structs.
-	type update struct {
-		Channel string `json:"channel"`
-		UUID    string `json:"uuid"`
-		Version string `json:"version"`
+	// Record the release.
+	p.releaseLastCheck = time.Now()
+	p.releaseVersion = latestUpdate.Version
+	p.releaseAssets = latestReleaseFiles
+	p.releaseManifest = releaseManifest
+
+	return nil
+}
+
+// getRelease returns the latest release, or the release with the requested version if one is provided.
+func (p *operationsCenter) getRelease(ctx context.Context, version string) (string, []string, manifest, error) {
+	if version == "" {
+		err := p.checkRelease(ctx)
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		return p.releaseVersion, p.releaseAssets, p.releaseManifest, nil
 	}
 
-	type updateFile struct {
-		Filename     string `json:"filename"`
-		Size         int64  `json:"size"`
-		Component    string `json:"component"`
-		Type         string `json:"type"`
-		Architecture string `json:"architecture"`
+	// Look for the requested version, in any channel.
+	entry, err := p.findUpdate(ctx, func(entry operationsCenterUpdate) bool { return SameVersion(entry.Version, version) })
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	releaseFiles, releaseManifest, err := p.getReleaseFiles(ctx, entry)
+	if err != nil {
+		return "", nil, nil, err
 	}
 
-	// Get the latest release.
+	return entry.Version, releaseFiles, releaseManifest, nil
+}
+
+// findUpdate returns the first (newest) update matching the filter.
+func (p *operationsCenter) findUpdate(ctx context.Context, filter func(entry operationsCenterUpdate) bool) (*operationsCenterUpdate, error) {
+	// Get the release list.
 	apiResp, err := p.apiRequest(ctx, http.MethodGet, "/1.0/provisioning/updates?recursion=1", nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Parse the update list.
-	updates := []update{}
+	updates := []operationsCenterUpdate{}
 	err = apiResp.MetadataAsStruct(&updates)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if len(updates) == 0 {
-		return errors.New("no update available")
+	for _, entry := range updates {
+		if filter(entry) {
+			return &entry, nil
+		}
 	}
 
-	// Get the latest release.
-	latestRelease := updates[0].Version
+	return nil, ErrNoUpdateAvailable
+}
+
+// getReleaseFiles returns the files of an update for the local architecture along with its signed manifest.
+func (p *operationsCenter) getReleaseFiles(ctx context.Context, entry *operationsCenterUpdate) ([]string, manifest, error) {
+	// Get local architecture.
+	archName, err := osarch.ArchitectureGetLocal()
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Get the file list.
-	apiResp, err = p.apiRequest(ctx, http.MethodGet, "/1.0/provisioning/updates/"+updates[0].UUID+"/files", nil)
+	apiResp, err := p.apiRequest(ctx, http.MethodGet, "/1.0/provisioning/updates/"+entry.UUID+"/files", nil)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	// Parse the file list.
-	files := []updateFile{}
+	files := []operationsCenterUpdateFile{}
 	err = apiResp.MetadataAsStruct(&files)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	if len(files) == 0 {
-		return errors.New("no files in update")
+		return nil, nil, errors.New("no files in update")
 	}
 
-	latestReleaseFiles := make([]string, 0, len(files))
+	releaseURL := p.serverURL + "/1.0/provisioning/updates/" + entry.UUID + "/files/"
+
+	releaseFiles := make([]string, 0, len(files))
 	for _, file := range files {
 		if file.Architecture != archName {
 			continue
 		}
 
-		latestReleaseFiles = append(latestReleaseFiles, p.serverURL+"/1.0/provisioning/updates/"+updates[0].UUID+"/files/"+file.Filename)
+		releaseFiles = append(releaseFiles, releaseURL+file.Filename)
 	}
 
-	// Record the release.
-	p.releaseLastCheck = time.Now()
-	p.releaseVersion = latestRelease
-	p.releaseAssets = latestReleaseFiles
+	releaseFiles, err = filterArchAssets(releaseFiles)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return nil
-}
+	// Get the signed release manifest.
+	manifestBody, err := p.getFile(ctx, releaseURL+manifestName)
+	if err != nil {
+		return nil, nil, err
+	}
 
-func (p *operationsCenter) downloadAsset(ctx context.Context, assetURL string, target string, progressFunc func(float64)) error {
-	// Prepare the request.
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, assetURL, nil)
+	manifestSignature, err := p.getFile(ctx, releaseURL+manifestSignatureName)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	// Get a reader for the release asset.
-	resp, err := p.client.Do(req)
+	releaseManifest, err := parseManifest(manifestBody, manifestSignature)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	defer resp.Body.Close()
+	return releaseFiles, releaseManifest, nil
+}
 
-	// Get the release asset size.
-	srcSize := float64(resp.ContentLength)
+func (p *operationsCenter) getFile(ctx context.Context, fileURL string) ([]byte, error) {
+	// Prepare the request.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
 
-	// Setup a gzip reader to decompress during streaming.
-	body, err := gzip.NewReader(resp.Body)
+	// Fetch the file.
+	resp, err := p.client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	defer body.Close()
+	defer resp.Body.Close()
 
-	// Create the target path.
-	// #nosec G304
-	fd, err := os.Create(target)
-	if err != nil {
-		return err
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %q: %s", filepath.Base(fileURL), resp.Status)
 	}
 
-	defer fd.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (p *operationsCenter) downloadAsset(ctx context.Context, assetURL string, m manifest, target string, progressFunc func(Progress)) error {
+	// Download, validate and decompress the asset into place. Files are only available to
+	// registered servers, so they're never shared with peers.
+	return fetchAsset(withPrivateAssets(ctx), httpAssetSource(p.client, assetURL), filepath.Base(assetURL), m, target, true, progressFunc)
+}
 
-	// Read from the decompressor in chunks to avoid excessive memory consumption.
-	count := int64(0)
-	for {
-		_, err = io.CopyN(fd, body, 4*1024*1024)
+// assetsSize returns the combined size of the provided release files, or -1 if unknown.
+func (p *operationsCenter) assetsSize(ctx context.Context, assetURLs []string) (int64, error) {
+	total := int64(0)
+	for _, assetURL := range assetURLs {
+		size, err := httpAssetSize(ctx, p.client, assetURL)
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
-
-			return err
+			return 0, err
 		}
 
-		// Update progress every 24MiB.
-		if count%6 == 0 {
-			progressFunc(float64(count*4*1024*1024) / srcSize)
-		}
-		count++
+		total = addAssetSize(total, size)
 	}
 
-	return nil
+	return total, nil
 }
 
 // An application from the Operations Center provider.
 type operationsCenterApplication struct {
 	provider *operationsCenter
 
-	assets  []string
-	name    string
-	version string
+	assets   []string
+	manifest manifest
+	name     string
+	version  string
 }
 
 func (a *operationsCenterApplication) Name() string {
@@ -473,54 +546,66 @@ func (a *operationsCenterApplication) Version() string {
 	return a.version
 }
 
-func (a *operationsCenterApplication) IsNewerThan(otherVersion string) bool {
-	return datetimeComparison(a.version, otherVersion)
+func (a *operationsCenterApplication) IsNewerThan(otherVersion string) (bool, error) {
+	return isNewerVersion(a.version, otherVersion)
 }
 
-func (a *operationsCenterApplication) Download(ctx context.Context, target string, progressFunc func(float64)) error {
+func (a *operationsCenterApplication) Download(ctx context.Context, target string, progressFunc func(Progress)) error {
 	// Create the target path.
 	err := os.MkdirAll(target, 0o700)
 	if err != nil {
 		return err
 	}
 
-	for _, asset := range a.assets {
-		fileName := filepath.Base(asset)
+	for _, asset := range a.selectAssets() {
+		// Download the application.
+		err = a.provider.downloadAsset(ctx, asset, a.manifest, filepath.Join(target, localAssetName(filepath.Base(asset))), progressFunc)
+		if err != nil {
+			return err
+		}
+	}
 
-		appName := strings.TrimSuffix(fileName, ".raw.gz")
+	return nil
+}
 
+func (a *operationsCenterApplication) DownloadSize(ctx context.Context) (int64, error) {
+	return a.provider.assetsSize(ctx, a.selectAssets())
+}
+
+// selectAssets returns the release files making up the application.
+func (a *operationsCenterApplication) selectAssets() []string {
+	assets := []string{}
+
+	for _, asset := range a.assets {
 		// Only select the desired applications.
-		if appName != a.name {
+		if localAssetName(filepath.Base(asset)) != a.name+".raw" || !strings.HasSuffix(asset, ".gz") {
 			continue
 		}
 
-		// Download the application.
-		err = a.provider.downloadAsset(ctx, asset, filepath.Join(target, strings.TrimSuffix(fileName, ".gz")), progressFunc)
-		if err != nil {
-			return err
-		}
+		assets = append(assets, asset)
 	}
 
-	return nil
+	return assets
 }
 
 // An update from the Operations Center provider.
 type operationsCenterOSUpdate struct {
 	provider *operationsCenter
 
-	assets  []string
-	version string
+	assets   []string
+	manifest manifest
+	version  string
 }
 
 func (o *operationsCenterOSUpdate) Version() string {
 	return o.version
 }
 
-func (o *operationsCenterOSUpdate) IsNewerThan(otherVersion string) bool {
-	return datetimeComparison(o.version, otherVersion)
+func (o *operationsCenterOSUpdate) IsNewerThan(otherVersion string) (bool, error) {
+	return isNewerVersion(o.version, otherVersion)
 }
 
-func (o *operationsCenterOSUpdate) Download(ctx context.Context, osName string, target string, progressFunc func(float64)) error {
+func (o *operationsCenterOSUpdate) Download(ctx context.Context, osName string, target string, progressFunc func(Progress)) error {
 	// Clear the target path.
 	err := os.RemoveAll(target)
 	if err != nil && !os.IsNotExist(err) {
@@ -533,6 +618,27 @@ func (o *operationsCenterOSUpdate) Download(ctx context.Context, osName string,
 		return err
 	}
 
+	for _, asset := range o.selectAssets(osName) {
+		fileName := filepath.Base(asset)
+
+		// Download the actual update.
+		err = fetchOSAsset(ctx, o.provider.state, o.provider.config, fileName, o.manifest, filepath.Join(target, localAssetName(fileName)), httpDeltaSource(o.provider.client, o.assets), httpAssetSource(o.provider.client, asset), progressFunc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *operationsCenterOSUpdate) DownloadSize(ctx context.Context, osName string) (int64, error) {
+	return o.provider.assetsSize(ctx, o.selectAssets(osName))
+}
+
+// selectAssets returns the release files making up the OS update.
+func (o *operationsCenterOSUpdate) selectAssets(osName string) []string {
+	assets := []string{}
+
 	for _, asset := range o.assets {
 		fileName := filepath.Base(asset)
 
@@ -541,23 +647,24 @@ func (o *operationsCenterOSUpdate) Download(ctx context.Context, osName string,
 			continue
 		}
 
+		// Skip update deltas.
+		if isDeltaAsset(fileName) {
+			continue
+		}
+
 		// Parse the file names.
-		fields := strings.SplitN(fileName, ".", 2)
+		fields := strings.SplitN(localAssetName(fileName), ".", 2)
 		if len(fields) != 2 {
 			continue
 		}
 
 		// Skip the full image.
-		if fields[1] == "img.gz" || fields[1] == "iso.gz" {
+		if fields[1] == "img" || fields[1] == "iso" {
 			continue
 		}
 
-		// Download the actual update.
-		err = o.provider.downloadAsset(ctx, asset, filepath.Join(target, strings.TrimSuffix(fileName, ".gz")), progressFunc)
-		if err != nil {
-			return err
-		}
+		assets = append(assets, asset)
 	}
 
-	return nil
+	return assets
 }
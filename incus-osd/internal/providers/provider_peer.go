@@ -0,0 +1,279 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lxc/incus-os/incus-osd/internal/state"
+)
+
+// peerConfigKeys are the configuration keys of the peer provider, any other key is passed to the upstream provider.
+var peerConfigKeys = []string{"upstream", "peers", "peer_domain"}
+
+// peerIdleTimeout is how long a peer cache may stall while sending a release file before giving up on it.
+var peerIdleTimeout = 30 * time.Second
+
+// peerSourcesKey is the context key holding the peer caches to try before downloading from upstream.
+type peerSourcesKey struct{}
+
+// peerSources holds the peer caches to download release files from.
+type peerSources struct {
+	client *http.Client
+	urls   []string
+
+	// Whether any release file was (at least partly) received from a peer.
+	used atomic.Bool
+}
+
+// The Peer provider, getting releases from an upstream provider while downloading their files from
+// the peer caches of other systems on the local network whenever possible.
+type peer struct {
+	config map[string]string
+	state  *state.State
+
+	client   *http.Client
+	upstream Provider
+	peers    []string
+	domain   string
+}
+
+func (p *peer) ClearCache(ctx context.Context) error {
+	return p.upstream.ClearCache(ctx)
+}
+
+func (p *peer) Register(ctx context.Context) error {
+	return p.upstream.Register(ctx)
+}
+
+func (*peer) Type() string {
+	return "peer"
+}
+
+func (p *peer) Channel() string {
+	return p.upstream.Channel()
+}
+
+func (p *peer) GetOSUpdate(ctx context.Context, osName string, version string) (OSUpdate, error) {
+	// Get the release from upstream.
+	update, err := p.upstream.GetOSUpdate(ctx, osName, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return &peerOSUpdate{OSUpdate: update, provider: p}, nil
+}
+
+func (p *peer) GetApplication(ctx context.Context, name string, version string) (Application, error) {
+	// Get the release from upstream.
+	app, err := p.upstream.GetApplication(ctx, name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return &peerApplication{Application: app, provider: p}, nil
+}
+
+func (p *peer) load(ctx context.Context) error {
+	// Get the peer caches.
+	for _, peerURL := range strings.Split(p.config["peers"], ",") {
+		peerURL = strings.TrimSuffix(strings.TrimSpace(peerURL), "/")
+		if peerURL == "" {
+			continue
+		}
+
+		u, err := url.Parse(peerURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid peer %q", peerURL)
+		}
+
+		p.peers = append(p.peers, peerURL)
+	}
+
+	p.domain = p.config["peer_domain"]
+
+	if len(p.peers) == 0 && p.domain == "" {
+		return errors.New("no peers or peer domain provided")
+	}
+
+	// Peers are on the local network, so don't use the proxy and give up quickly on unreachable ones.
+	p.client = &http.Client{
+		Transport: &http.Transport{
+			DialContext:           (&net.Dialer{Timeout: 5 * time.Second}).DialContext,
+			ResponseHeaderTimeout: 10 * time.Second,
+		},
+	}
+
+	// Setup the upstream provider.
+	upstream := p.config["upstream"]
+	if upstream == "" {
+		upstream = "github"
+	}
+
+	if upstream == "peer" {
+		return errors.New("the peer provider can't be its own upstream")
+	}
+
+	upstreamConfig := maps.Clone(p.config)
+	for _, key := range peerConfigKeys {
+		delete(upstreamConfig, key)
+	}
+
+	var err error
+
+	p.upstream, err = Load(ctx, p.state, upstream, upstreamConfig)
+	if err != nil {
+		return fmt.Errorf("failed to load upstream provider %q: %w", upstream, err)
+	}
+
+	return nil
+}
+
+// withPeers returns a context making downloads try the configured and discovered peer caches first.
+func (p *peer) withPeers(ctx context.Context) context.Context {
+	urls := append([]string{}, p.peers...)
+
+	// Discover peers through the "_incus-os-cache._tcp" DNS SRV records of the peer domain.
+	if p.domain != "" {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "incus-os-cache", "tcp", p.domain)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to discover peer update caches", "domain", p.domain, "err", err)
+		}
+
+		for _, record := range records {
+			urls = append(urls, "http://"+net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))))
+		}
+	}
+
+	return context.WithValue(ctx, peerSourcesKey{}, &peerSources{client: p.client, urls: urls})
+}
+
+// download runs the provided download through the peer caches. As peers aren't trusted, a download failing
+// after receiving data from a peer (invalid or stalled file, dropped connection, ...) is retried straight from upstream.
+func (p *peer) download(ctx context.Context, name string, downloadFunc func(ctx context.Context) error) error {
+	peerCtx := p.withPeers(ctx)
+
+	err := downloadFunc(peerCtx)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	peers, ok := peerCtx.Value(peerSourcesKey{}).(*peerSources)
+	if !ok || !peers.used.Load() {
+		return err
+	}
+
+	slog.WarnContext(ctx, "Failed to download from peer update cache, downloading from upstream", "name", name, "err", err)
+
+	return downloadFunc(ctx)
+}
+
+// peerAssetSource returns an assetSource trying the peer caches held in the context before the provided source,
+// along with a function reporting whether the asset was received from a peer.
+func peerAssetSource(ctx context.Context, hash string, src assetSource) (assetSource, func() bool) {
+	peers, ok := ctx.Value(peerSourcesKey{}).(*peerSources)
+	if !ok || len(peers.urls) == 0 {
+		return src, func() bool { return false }
+	}
+
+	var fromPeer bool
+
+	return func(ctx context.Context, offset int64) (io.ReadCloser, int64, int64, error) {
+			for _, peerURL := range peers.urls {
+				// Give up on the peer if it stops sending data.
+				peerCtx, cancel := context.WithCancelCause(ctx)
+
+				rc, peerOffset, size, err := httpAssetSource(peers.client, peerURL+"/1.0/cache/"+hash)(peerCtx, offset)
+				if err != nil {
+					cancel(nil)
+
+					slog.DebugContext(ctx, "Release file unavailable from peer", "peer", peerURL, "err", err)
+
+					continue
+				}
+
+				fromPeer = true
+
+				peers.used.Store(true)
+
+				return newPeerReader(peerCtx, rc, cancel), peerOffset, size, nil
+			}
+
+			return src(ctx, offset)
+		}, func() bool {
+			return fromPeer
+		}
+}
+
+// peerReader reads a release file from a peer, aborting the transfer when the peer stalls.
+type peerReader struct {
+	rc     io.ReadCloser
+	cause  func() error
+	cancel context.CancelCauseFunc
+	timer  *time.Timer
+}
+
+func newPeerReader(ctx context.Context, rc io.ReadCloser, cancel context.CancelCauseFunc) *peerReader {
+	return &peerReader{
+		rc:     rc,
+		cause:  func() error { return context.Cause(ctx) },
+		cancel: cancel,
+		timer: time.AfterFunc(peerIdleTimeout, func() {
+			cancel(fmt.Errorf("peer sent no data for %s", peerIdleTimeout))
+		}),
+	}
+}
+
+func (r *peerReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) && r.cause() != nil {
+		err = r.cause()
+	}
+
+	r.timer.Reset(peerIdleTimeout)
+
+	return n, err
+}
+
+func (r *peerReader) Close() error {
+	r.timer.Stop()
+	r.cancel(nil)
+
+	return r.rc.Close()
+}
+
+// An application from the Peer provider.
+type peerApplication struct {
+	Application
+
+	provider *peer
+}
+
+func (a *peerApplication) Download(ctx context.Context, target string, progressFunc func(Progress)) error {
+	return a.provider.download(ctx, a.Name(), func(ctx context.Context) error {
+		return a.Application.Download(ctx, target, progressFunc)
+	})
+}
+
+// An update from the Peer provider.
+type peerOSUpdate struct {
+	OSUpdate
+
+	provider *peer
+}
+
+func (o *peerOSUpdate) Download(ctx context.Context, osName string, target string, progressFunc func(Progress)) error {
+	return o.provider.download(ctx, osName, func(ctx context.Context) error {
+		return o.OSUpdate.Download(ctx, osName, target, progressFunc)
+	})
+}
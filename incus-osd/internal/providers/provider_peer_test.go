@@ -0,0 +1,220 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerProvider(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	StagingPath = filepath.Join(tmpDir, "staging")
+	PeerCachePath = filepath.Join(tmpDir, "cache")
+
+	peerCacheEnabled.Store(true)
+	t.Cleanup(func() { peerCacheEnabled.Store(false) })
+
+	srv := newMirrorTestServer(t, "202501010000", map[string][]byte{"incus.raw": []byte("incus")})
+	cache := httptest.NewServer(newPeerCacheHandler())
+	t.Cleanup(cache.Close)
+
+	// A first system downloads the application, adding it to its cache.
+	p, err := Load(ctx, nil, "mirror", map[string]string{"url": srv.URL})
+	require.NoError(t, err)
+
+	app, err := p.GetApplication(ctx, "incus", "")
+	require.NoError(t, err)
+
+	err = app.Download(ctx, filepath.Join(tmpDir, "first"), func(Progress) {})
+	require.NoError(t, err)
+
+	compressed := srv.files["202501010000/incus.raw.gz"]
+	hash := sha256.Sum256(compressed)
+	cachePath := filepath.Join(PeerCachePath, hex.EncodeToString(hash[:]))
+
+	data, err := os.ReadFile(cachePath)
+	require.NoError(t, err)
+	require.Equal(t, compressed, data)
+
+	// A second system gets the release from upstream, but the file from its peer.
+	p, err = Load(ctx, nil, "peer", map[string]string{"upstream": "mirror", "url": srv.URL, "peers": cache.URL})
+	require.NoError(t, err)
+	require.Equal(t, "peer", p.Type())
+
+	app, err = p.GetApplication(ctx, "incus", "")
+	require.NoError(t, err)
+
+	delete(srv.files, "202501010000/incus.raw.gz")
+
+	err = app.Download(ctx, filepath.Join(tmpDir, "second"), func(Progress) {})
+	require.NoError(t, err)
+
+	data, err = os.ReadFile(filepath.Join(tmpDir, "second", "incus.raw"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("incus"), data)
+
+	// Invalid files from peers are replaced by the upstream ones.
+	srv.files["202501010000/incus.raw.gz"] = compressed
+	require.NoError(t, os.WriteFile(cachePath, []byte("evil"), 0o600))
+
+	err = app.Download(ctx, filepath.Join(tmpDir, "third"), func(Progress) {})
+	require.NoError(t, err)
+
+	data, err = os.ReadFile(filepath.Join(tmpDir, "third", "incus.raw"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("incus"), data)
+
+	data, err = os.ReadFile(cachePath)
+	require.NoError(t, err)
+	require.Equal(t, compressed, data)
+
+	// Only valid checksums are served.
+	_, _, _, err = httpAssetSource(cache.Client(), cache.URL+"/1.0/cache/..")(ctx, 0)
+	require.Error(t, err)
+
+	// A peer provider needs peers.
+	_, err = Load(ctx, nil, "peer", map[string]string{"upstream": "mirror", "url": srv.URL})
+	require.Error(t, err)
+}
+
+func TestPeerProviderStalled(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	StagingPath = filepath.Join(tmpDir, "staging")
+
+	peerIdleTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { peerIdleTimeout = 30 * time.Second })
+
+	srv := newMirrorTestServer(t, "202501010000", map[string][]byte{"incus.raw": []byte("incus")})
+
+	// A peer sending part of a bogus file, then nothing.
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1024")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("evil"))
+		w.(http.Flusher).Flush()
+
+		<-r.Context().Done()
+	}))
+	t.Cleanup(stalled.Close)
+
+	p, err := Load(ctx, nil, "peer", map[string]string{"upstream": "mirror", "url": srv.URL, "peers": stalled.URL})
+	require.NoError(t, err)
+
+	app, err := p.GetApplication(ctx, "incus", "")
+	require.NoError(t, err)
+
+	// The download falls back to upstream.
+	err = app.Download(ctx, filepath.Join(tmpDir, "app"), func(Progress) {})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, "app", "incus.raw"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("incus"), data)
+}
+
+func TestPeerCacheCleanup(t *testing.T) { //nolint:paralleltest
+	PeerCachePath = t.TempDir()
+
+	peerCacheEnabled.Store(true)
+	t.Cleanup(func() { peerCacheEnabled.Store(false) })
+
+	peerCacheMaxSize = 12
+	t.Cleanup(func() { peerCacheMaxSize = int64(8 * 1024 * 1024 * 1024) })
+
+	// Add files from oldest to newest.
+	now := time.Now()
+	hashes := []string{}
+
+	for i, content := range []string{"expired", "oldest", "older", "newest"} {
+		hash := sha256.Sum256([]byte(content))
+		hashes = append(hashes, hex.EncodeToString(hash[:]))
+
+		partialPath := filepath.Join(t.TempDir(), "partial")
+		require.NoError(t, os.WriteFile(partialPath, []byte(content), 0o600))
+
+		modTime := now.Add(time.Duration(i-3) * time.Minute)
+		if content == "expired" {
+			modTime = now.Add(-2 * peerCacheMaxAge)
+		}
+
+		require.NoError(t, os.Chtimes(partialPath, modTime, modTime))
+
+		addPeerCache(context.Background(), partialPath, hashes[i])
+	}
+
+	// Only the most recent files fitting within the maximum size are kept.
+	for i, kept := range []bool{false, false, true, true} {
+		_, err := os.Stat(filepath.Join(PeerCachePath, hashes[i]))
+		require.Equal(t, kept, err == nil, i)
+	}
+
+	// The newest file is kept even when too large.
+	peerCacheMaxSize = 1
+
+	require.NoError(t, cleanupPeerCache())
+
+	entries, err := os.ReadDir(PeerCachePath)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, hashes[3], entries[0].Name())
+}
+
+func TestPeerCacheAddress(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		address  string
+		expected string
+	}{
+		{"10.0.0.10", "10.0.0.10:8444"},
+		{"10.0.0.10:9000", "10.0.0.10:9000"},
+		{"fd00::10", "[fd00::10]:8444"},
+		{"[fd00::10]:9000", "[fd00::10]:9000"},
+		{"", ""},
+		{":8444", ""},
+		{"0.0.0.0:8444", ""},
+		{"[::]:8444", ""},
+		{"cache.example.com:8444", ""},
+	}
+
+	for _, tt := range tests {
+		address, err := PeerCacheAddress(tt.address)
+		if tt.expected == "" {
+			require.Error(t, err, tt.address)
+
+			continue
+		}
+
+		require.NoError(t, err, tt.address)
+		require.Equal(t, tt.expected, address, tt.address)
+	}
+}
+
+func TestPeerCachePrivateAssets(t *testing.T) { //nolint:paralleltest
+	PeerCachePath = t.TempDir()
+
+	peerCacheEnabled.Store(true)
+	t.Cleanup(func() { peerCacheEnabled.Store(false) })
+
+	partialPath := filepath.Join(t.TempDir(), "partial")
+	require.NoError(t, os.WriteFile(partialPath, []byte("private"), 0o600))
+
+	hash := sha256.Sum256([]byte("private"))
+
+	// Files from providers requiring credentials are never served to peers.
+	addPeerCache(withPrivateAssets(context.Background()), partialPath, hex.EncodeToString(hash[:]))
+
+	entries, err := os.ReadDir(PeerCachePath)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
@@ -0,0 +1,160 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lxc/incus/v6/shared/subprocess"
+	"golang.org/x/sys/unix"
+)
+
+// removableDevicePath is where labelled filesystems show up.
+var removableDevicePath = "/dev/disk/by-label/"
+
+// removableMountPath is where the update media gets temporarily mounted.
+var removableMountPath = "/run/incus-os/media/"
+
+// The Removable media provider.
+type removable struct {
+	config  map[string]string
+	label   string
+	path    string
+	channel string
+
+	releaseAssets   []string
+	releaseManifest manifest
+	releaseVersion  string
+
+	mediaMu sync.Mutex
+}
+
+func (*removable) ClearCache(_ context.Context) error {
+	// No cache for the removable media provider.
+	return nil
+}
+
+func (*removable) Register(_ context.Context) error {
+	// No registration with the removable media provider.
+	return ErrRegistrationUnsupported
+}
+
+func (*removable) Type() string {
+	return "removable"
+}
+
+func (p *removable) Channel() string {
+	return p.channel
+}
+
+func (p *removable) GetOSUpdate(ctx context.Context, osName string, version string) (OSUpdate, error) {
+	// Get latest release.
+	err := p.checkRelease(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only a single release is available.
+	if version != "" && !SameVersion(version, p.releaseVersion) {
+		return nil, ErrNoUpdateAvailable
+	}
+
+	return getBundleOSUpdate(p, osName, p.releaseVersion, p.releaseAssets, p.releaseManifest)
+}
+
+func (p *removable) GetApplication(ctx context.Context, name string, version string) (Application, error) {
+	// Get latest release.
+	err := p.checkRelease(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only a single release is available.
+	if version != "" && !SameVersion(version, p.releaseVersion) {
+		return nil, ErrNoUpdateAvailable
+	}
+
+	return getBundleApplication(p, name, p.releaseVersion, p.releaseAssets, p.releaseManifest)
+}
+
+func (p *removable) load(_ context.Context) error {
+	// Get the filesystem label to look for.
+	p.label = p.config["label"]
+	if p.label == "" {
+		p.label = "INCUSOS-UPD"
+	}
+
+	if p.label != filepath.Base(p.label) || p.label == ".." {
+		return fmt.Errorf("invalid media label %q", p.label)
+	}
+
+	// Releases are read from a directory at the root of the media.
+	p.path = "incus-os"
+
+	// Non-default channels are read from a sub-directory.
+	p.channel = p.config["channel"]
+	if p.channel == "" {
+		p.channel = DefaultChannel
+	} else {
+		if p.channel != filepath.Base(p.channel) || p.channel == ".." {
+			return fmt.Errorf("invalid channel %q", p.channel)
+		}
+
+		p.path = filepath.Join(p.path, p.channel)
+	}
+
+	return nil
+}
+
+// withBundle mounts the update media read-only for the duration of the provided function.
+func (p *removable) withBundle(ctx context.Context, f func(root string) error) error {
+	p.mediaMu.Lock()
+	defer p.mediaMu.Unlock()
+
+	// Check if the media is present.
+	device := filepath.Join(removableDevicePath, p.label)
+
+	_, err := os.Stat(device)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrNoUpdateAvailable
+		}
+
+		return err
+	}
+
+	// Mount the media.
+	err = os.MkdirAll(removableMountPath, 0o700)
+	if err != nil {
+		return err
+	}
+
+	_, err = subprocess.RunCommandContext(ctx, "mount", "-o", "ro,nodev,nosuid,noexec", device, removableMountPath)
+	if err != nil {
+		return fmt.Errorf("failed to mount update media %q: %w", p.label, err)
+	}
+
+	defer func() { _ = unix.Unmount(removableMountPath, 0) }()
+
+	return f(filepath.Join(removableMountPath, p.path))
+}
+
+func (p *removable) checkRelease(ctx context.Context) error {
+	return p.withBundle(ctx, func(root string) error {
+		version, assets, m, err := readBundle(root)
+		if err != nil {
+			return err
+		}
+
+		// Record the release.
+		p.releaseVersion = version
+		p.releaseAssets = assets
+		p.releaseManifest = m
+
+		return nil
+	})
+}
@@ -2,24 +2,51 @@ package providers
 
 import (
 	"context"
-	"strconv"
 )
 
+// DefaultChannel is the update channel used when none is configured.
+var DefaultChannel = "stable"
+
+// SensitiveConfigKeys lists the provider configuration keys which must never be exposed through the API.
+var SensitiveConfigKeys = []string{"password", "server_token", "token"}
+
+// Progress reports how much of a release asset has been downloaded.
+type Progress struct {
+	Asset string
+
+	// Bytes downloaded so far out of the total size (-1 if unknown).
+	Bytes int64
+	Total int64
+}
+
+// Fraction returns the downloaded fraction of the asset, zero if the total size isn't known.
+func (p Progress) Fraction() float64 {
+	if p.Total <= 0 {
+		return 0
+	}
+
+	return float64(p.Bytes) / float64(p.Total)
+}
+
 // Application represents an application to be installed on top of Incus OS.
 type Application interface {
 	Name() string
 	Version() string
-	IsNewerThan(otherVersion string) bool
+	IsNewerThan(otherVersion string) (bool, error)
 
-	Download(ctx context.Context, targetPath string, progressFunc func(float64)) error
+	// DownloadSize returns the number of bytes Download would fetch, or -1 if unknown.
+	DownloadSize(ctx context.Context) (int64, error)
+	Download(ctx context.Context, targetPath string, progressFunc func(Progress)) error
 }
 
 // OSUpdate represents a full OS update.
 type OSUpdate interface {
 	Version() string
-	IsNewerThan(otherVersion string) bool
+	IsNewerThan(otherVersion string) (bool, error)
 
-	Download(ctx context.Context, osName string, targetPath string, progressFunc func(float64)) error
+	// DownloadSize returns the number of bytes Download would fetch, or -1 if unknown.
+	DownloadSize(ctx context.Context, osName string) (int64, error)
+	Download(ctx context.Context, osName string, targetPath string, progressFunc func(Progress)) error
 }
 
 // Provider represents an update/application provider.
@@ -27,27 +54,13 @@ type Provider interface {
 	ClearCache(ctx context.Context) error
 
 	Type() string
+	Channel() string
 
-	GetOSUpdate(ctx context.Context, osName string) (OSUpdate, error)
-	GetApplication(ctx context.Context, name string) (Application, error)
+	// GetOSUpdate and GetApplication return the latest release, unless a specific version is requested.
+	GetOSUpdate(ctx context.Context, osName string, version string) (OSUpdate, error)
+	GetApplication(ctx context.Context, name string, version string) (Application, error)
 
 	Register(ctx context.Context) error
 
 	load(ctx context.Context) error
 }
-
-// datetimeComparison takes two strings of the format YYYYMMDDhhmm and returns a boolean
-// indicating if a > b. If either string can't be converted to an int, false is returned.
-func datetimeComparison(a string, b string) bool {
-	aInt, err := strconv.Atoi(a)
-	if err != nil {
-		return false
-	}
-
-	bInt, err := strconv.Atoi(b)
-	if err != nil {
-		return false
-	}
-
-	return aInt > bInt
-}
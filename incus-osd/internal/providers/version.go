@@ -0,0 +1,246 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidVersion is returned when a version string can't be parsed.
+var ErrInvalidVersion = errors.New("invalid version")
+
+// ErrIncomparableVersions is returned when comparing versions using different schemes.
+var ErrIncomparableVersions = errors.New("versions use different schemes")
+
+// VersionScheme identifies how a version string is structured.
+type VersionScheme string
+
+const (
+	// VersionSchemeDatetime is the YYYYMMDDhhmm scheme used by Incus OS releases.
+	VersionSchemeDatetime VersionScheme = "datetime"
+
+	// VersionSchemeSemver is the MAJOR.MINOR.PATCH semantic versioning scheme.
+	VersionSchemeSemver VersionScheme = "semver"
+)
+
+var (
+	versionDatetimeRegex = regexp.MustCompile(`^([0-9]{12})(?:[-~]([0-9A-Za-z.-]+))?$`)
+	versionSemverRegex   = regexp.MustCompile(`^v?([0-9]+)(?:\.([0-9]+))?(?:\.([0-9]+))?(?:[-~]([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+)
+
+// Version is a parsed release version.
+//
+// Both the YYYYMMDDhhmm datetime scheme and semantic versioning are supported, either of them
+// optionally followed by a suffix (for example "-dev" or "-rc1") marking a build which sorts
+// before the matching release. Suffixes are compared identifier by identifier, with numbers
+// compared numerically, so "rc2" sorts before "rc10".
+type Version struct {
+	raw        string
+	scheme     VersionScheme
+	numbers    []uint64
+	prerelease []string
+}
+
+// ParseVersion parses a version string.
+func ParseVersion(s string) (*Version, error) {
+	value := strings.TrimSpace(s)
+
+	// Datetime based versions.
+	match := versionDatetimeRegex.FindStringSubmatch(value)
+	if match != nil {
+		_, err := time.Parse("200601021504", match[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: bad date", ErrInvalidVersion, s)
+		}
+
+		number, _ := strconv.ParseUint(match[1], 10, 64)
+
+		return &Version{
+			raw:        s,
+			scheme:     VersionSchemeDatetime,
+			numbers:    []uint64{number},
+			prerelease: splitPrerelease(match[2]),
+		}, nil
+	}
+
+	// Semantic versions.
+	match = versionSemverRegex.FindStringSubmatch(value)
+	if match != nil {
+		v := &Version{
+			raw:        s,
+			scheme:     VersionSchemeSemver,
+			numbers:    make([]uint64, 3),
+			prerelease: splitPrerelease(match[4]),
+		}
+
+		for i, field := range match[1:4] {
+			if field == "" {
+				continue
+			}
+
+			number, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w %q: %w", ErrInvalidVersion, s, err)
+			}
+
+			v.numbers[i] = number
+		}
+
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrInvalidVersion, s)
+}
+
+// String returns the version as originally provided.
+func (v *Version) String() string {
+	return v.raw
+}
+
+// Scheme returns the versioning scheme in use.
+func (v *Version) Scheme() VersionScheme {
+	return v.scheme
+}
+
+// IsPrerelease returns whether the version carries a suffix (dev, rc, ...).
+func (v *Version) IsPrerelease() bool {
+	return len(v.prerelease) > 0
+}
+
+// Compare returns -1, 0 or 1 depending on whether the version is older, the same or newer
+// than the other one. Versions using different schemes can't be compared.
+func (v *Version) Compare(other *Version) (int, error) {
+	if v.scheme != other.scheme {
+		return 0, fmt.Errorf("%w (%q is %s, %q is %s)", ErrIncomparableVersions, v.raw, v.scheme, other.raw, other.scheme)
+	}
+
+	// Compare the release numbers.
+	for i := range v.numbers {
+		if v.numbers[i] != other.numbers[i] {
+			if v.numbers[i] > other.numbers[i] {
+				return 1, nil
+			}
+
+			return -1, nil
+		}
+	}
+
+	// A release sorts after any of its pre-releases.
+	switch {
+	case len(v.prerelease) == 0 && len(other.prerelease) == 0:
+		return 0, nil
+	case len(v.prerelease) == 0:
+		return 1, nil
+	case len(other.prerelease) == 0:
+		return -1, nil
+	}
+
+	for i := range min(len(v.prerelease), len(other.prerelease)) {
+		ret := compareIdentifiers(v.prerelease[i], other.prerelease[i])
+		if ret != 0 {
+			return ret, nil
+		}
+	}
+
+	switch {
+	case len(v.prerelease) > len(other.prerelease):
+		return 1, nil
+	case len(v.prerelease) < len(other.prerelease):
+		return -1, nil
+	}
+
+	return 0, nil
+}
+
+// CompareVersions parses and compares two version strings, see Version.Compare.
+func CompareVersions(a string, b string) (int, error) {
+	versionA, err := ParseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	versionB, err := ParseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return versionA.Compare(versionB)
+}
+
+// SameVersion checks whether two version strings refer to the same version.
+// Strings which can't be parsed or compared are compared as-is.
+func SameVersion(a string, b string) bool {
+	ret, err := CompareVersions(a, b)
+	if err != nil {
+		return a == b
+	}
+
+	return ret == 0
+}
+
+// isNewerVersion returns whether version a is newer than version b.
+func isNewerVersion(a string, b string) (bool, error) {
+	ret, err := CompareVersions(a, b)
+	if err != nil {
+		return false, err
+	}
+
+	return ret > 0, nil
+}
+
+// splitPrerelease splits a version suffix into its identifiers, also separating
+// letters from digits so "rc1" becomes "rc" and "1".
+func splitPrerelease(suffix string) []string {
+	if suffix == "" {
+		return nil
+	}
+
+	identifiers := []string{}
+
+	for _, field := range strings.FieldsFunc(suffix, func(r rune) bool { return r == '.' || r == '-' }) {
+		start := 0
+
+		for i := 1; i < len(field); i++ {
+			if isDigit(field[i]) != isDigit(field[i-1]) {
+				identifiers = append(identifiers, field[start:i])
+				start = i
+			}
+		}
+
+		identifiers = append(identifiers, field[start:])
+	}
+
+	return identifiers
+}
+
+// compareIdentifiers compares two suffix identifiers following the semver rules:
+// numbers compare numerically and sort before alphanumeric identifiers.
+func compareIdentifiers(a string, b string) int {
+	numA, errA := strconv.ParseUint(a, 10, 64)
+	numB, errB := strconv.ParseUint(b, 10, 64)
+
+	switch {
+	case errA == nil && errB == nil:
+		switch {
+		case numA > numB:
+			return 1
+		case numA < numB:
+			return -1
+		}
+
+		return 0
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
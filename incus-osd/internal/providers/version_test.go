@@ -0,0 +1,53 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{"202501010000", "202412310000", 1},
+		{"202412310000", "202501010000", -1},
+		{"202501010000", "202501010000", 0},
+		{"202501010000-dev", "202501010000", -1},
+		{"202501010000-rc1", "202501010000-dev", 1},
+		{"202501010000-rc10", "202501010000-rc2", 1},
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.10.0", "1.9.0", 1},
+		{"1.2", "1.2.0", 0},
+		{"2.0.0-rc.1", "2.0.0", -1},
+		{"2.0.0-rc.1", "2.0.0-rc.1.1", -1},
+		{"2.0.0-alpha", "2.0.0-1", 1},
+		{"1.0.0+build5", "1.0.0+build6", 0},
+	}
+
+	for _, tt := range tests {
+		ret, err := CompareVersions(tt.a, tt.b)
+		require.NoError(t, err, "%s vs %s", tt.a, tt.b)
+		require.Equal(t, tt.expected, ret, "%s vs %s", tt.a, tt.b)
+	}
+}
+
+func TestCompareVersionsErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := CompareVersions("202501010000", "1.2.3")
+	require.ErrorIs(t, err, ErrIncomparableVersions)
+
+	for _, version := range []string{"", "latest", "202513010000", "1.2.3.4", "1.2.3-"} {
+		_, err := ParseVersion(version)
+		require.ErrorIs(t, err, ErrInvalidVersion, version)
+	}
+
+	require.True(t, SameVersion("v1.0.0", "1.0.0"))
+	require.False(t, SameVersion("latest", "1.0.0"))
+}
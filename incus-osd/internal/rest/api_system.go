@@ -3,8 +3,10 @@ package rest
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 
+	"github.com/lxc/incus-os/incus-osd/api"
 	"github.com/lxc/incus-os/incus-osd/internal/rest/response"
 )
 
@@ -32,8 +34,10 @@ func (s *Server) apiSystem(w http.ResponseWriter, r *http.Request) {
 
 	switch req.Action {
 	case "shutdown", "poweroff":
+		s.addLifecycleHistory(api.SystemHistoryTypeShutdown)
 		close(s.state.TriggerShutdown)
 	case "reboot":
+		s.addLifecycleHistory(api.SystemHistoryTypeReboot)
 		close(s.state.TriggerReboot)
 	case "update":
 		s.state.TriggerUpdate <- true
@@ -45,3 +49,17 @@ func (s *Server) apiSystem(w http.ResponseWriter, r *http.Request) {
 
 	_ = response.EmptySyncResponse.Render(w)
 }
+
+// addLifecycleHistory records a user requested reboot or shutdown.
+func (s *Server) addLifecycleHistory(historyType api.SystemHistoryType) {
+	err := s.state.AddHistory(api.SystemHistoryEntry{
+		Type:        historyType,
+		Outcome:     api.SystemHistoryOutcomeSuccess,
+		Component:   s.state.OS.Name,
+		FromVersion: s.state.OS.RunningRelease,
+		Message:     "Requested through the API",
+	})
+	if err != nil {
+		slog.Error("Failed to record history", "err", err.Error())
+	}
+}
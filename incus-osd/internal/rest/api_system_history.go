@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/lxc/incus-os/incus-osd/api"
+	"github.com/lxc/incus-os/incus-osd/internal/rest/response"
+)
+
+func (s *Server) apiSystemHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		// If none of the supported methods, return NotImplemented.
+		_ = response.NotImplemented(nil).Render(w)
+
+		return
+	}
+
+	// Parse the filters.
+	query := r.URL.Query()
+
+	var since, until time.Time
+
+	var err error
+
+	if query.Get("since") != "" {
+		since, err = time.Parse(time.RFC3339, query.Get("since"))
+		if err != nil {
+			_ = response.BadRequest(fmt.Errorf("invalid since value: %w", err)).Render(w)
+
+			return
+		}
+	}
+
+	if query.Get("until") != "" {
+		until, err = time.Parse(time.RFC3339, query.Get("until"))
+		if err != nil {
+			_ = response.BadRequest(fmt.Errorf("invalid until value: %w", err)).Render(w)
+
+			return
+		}
+	}
+
+	limit := 0
+
+	if query.Get("limit") != "" {
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit < 0 {
+			_ = response.BadRequest(fmt.Errorf("invalid limit value %q", query.Get("limit"))).Render(w)
+
+			return
+		}
+	}
+
+	// Get the history.
+	entries, err := s.state.GetHistory()
+	if err != nil {
+		_ = response.InternalError(err).Render(w)
+
+		return
+	}
+
+	// Return the matching entries, newest first.
+	resp := []api.SystemHistoryEntry{}
+
+	for _, entry := range slices.Backward(entries) {
+		if query.Has("type") && string(entry.Type) != query.Get("type") {
+			continue
+		}
+
+		if query.Has("outcome") && string(entry.Outcome) != query.Get("outcome") {
+			continue
+		}
+
+		if query.Has("component") && entry.Component != query.Get("component") {
+			continue
+		}
+
+		if !since.IsZero() && entry.Timestamp.Before(since) {
+			continue
+		}
+
+		if !until.IsZero() && entry.Timestamp.After(until) {
+			continue
+		}
+
+		resp = append(resp, entry)
+
+		if limit > 0 && len(resp) >= limit {
+			break
+		}
+	}
+
+	_ = response.SyncResponse(true, resp).Render(w)
+}
@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/lxc/incus-os/incus-osd/api"
+	"github.com/lxc/incus-os/incus-osd/internal/providers"
+	"github.com/lxc/incus-os/incus-osd/internal/rest/response"
+)
+
+// stripProviderConfig returns a copy of the provider configuration without any credentials.
+func stripProviderConfig(config map[string]string) map[string]string {
+	stripped := map[string]string{}
+
+	for key, value := range config {
+		if slices.Contains(providers.SensitiveConfigKeys, key) {
+			continue
+		}
+
+		stripped[key] = value
+	}
+
+	return stripped
+}
+
+func (s *Server) apiSystemProvider(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		// If none of the supported methods, return NotImplemented.
+		_ = response.NotImplemented(nil).Render(w)
+
+		return
+	}
+
+	// Strip any credentials from the configuration.
+	resp := s.state.System.Provider
+	resp.Config.Config = stripProviderConfig(s.state.System.Provider.Config.Config)
+	resp.Config.Fallbacks = make([]api.SystemProviderFallback, 0, len(s.state.System.Provider.Config.Fallbacks))
+
+	for _, fallback := range s.state.System.Provider.Config.Fallbacks {
+		resp.Config.Fallbacks = append(resp.Config.Fallbacks, api.SystemProviderFallback{
+			Name:   fallback.Name,
+			Config: stripProviderConfig(fallback.Config),
+		})
+	}
+
+	// Return the current provider configuration and state.
+	_ = response.SyncResponse(true, resp).Render(w)
+}
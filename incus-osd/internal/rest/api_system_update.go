@@ -0,0 +1,471 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/lxc/incus-os/incus-osd/api"
+	"github.com/lxc/incus-os/incus-osd/internal/maintenance"
+	"github.com/lxc/incus-os/incus-osd/internal/providers"
+	"github.com/lxc/incus-os/incus-osd/internal/rest/response"
+	"github.com/lxc/incus-os/incus-osd/internal/systemd"
+)
+
+func (s *Server) apiSystemUpdate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		// Report what an update check would do, without downloading anything.
+		if r.URL.Query().Has("dry-run") {
+			dryRun, err := strconv.ParseBool(r.URL.Query().Get("dry-run"))
+			if err != nil {
+				_ = response.BadRequest(fmt.Errorf("invalid dry-run value: %w", err)).Render(w)
+
+				return
+			}
+
+			if dryRun {
+				resp, err := s.updateDryRun(r.Context())
+				if err != nil {
+					_ = response.InternalError(err).Render(w)
+
+					return
+				}
+
+				_ = response.SyncResponse(true, resp).Render(w)
+
+				return
+			}
+		}
+
+		// Return the current update policy, along with the next maintenance windows.
+		resp := s.state.System.Update
+		now := time.Now()
+
+		for action, next := range map[maintenance.Action]**time.Time{
+			maintenance.ActionDownload:          &resp.State.NextDownload,
+			maintenance.ActionApplyApplications: &resp.State.NextApplyApplications,
+			maintenance.ActionReboot:            &resp.State.NextReboot,
+		} {
+			nextWindow, err := maintenance.NextWindow(resp.Config.Maintenance, action, now)
+			if err != nil {
+				_ = response.InternalError(err).Render(w)
+
+				return
+			}
+
+			*next = &nextWindow
+		}
+
+		// Report the images kept on disk.
+		var err error
+
+		resp.State.RetainedApplications, resp.State.RetainedOS, err = systemd.GetRetainedImages(r.Context())
+		if err != nil {
+			_ = response.InternalError(err).Render(w)
+
+			return
+		}
+
+		for _, images := range resp.State.RetainedApplications {
+			for _, image := range images {
+				resp.State.RetainedSize += image.Size
+			}
+		}
+
+		for _, image := range resp.State.RetainedOS {
+			resp.State.RetainedSize += image.Size
+		}
+
+		_ = response.SyncResponse(true, resp).Render(w)
+	case http.MethodPut:
+		// Update the configuration and/or trigger an action.
+		req := &api.SystemUpdatePut{}
+
+		err := json.NewDecoder(r.Body).Decode(req)
+		if err != nil {
+			_ = response.BadRequest(err).Render(w)
+
+			return
+		}
+
+		if req.Config != nil {
+			// Validate the pinned versions and maintenance windows.
+			err = validateUpdatePolicy("OS", req.Config.OS)
+			if err != nil {
+				_ = response.BadRequest(err).Render(w)
+
+				return
+			}
+
+			for appName, policy := range req.Config.Applications {
+				err = validateUpdatePolicy("application "+appName, policy)
+				if err != nil {
+					_ = response.BadRequest(err).Render(w)
+
+					return
+				}
+			}
+
+			err = maintenance.ValidateMaintenance(req.Config.Maintenance)
+			if err != nil {
+				_ = response.BadRequest(err).Render(w)
+
+				return
+			}
+
+			err = maintenance.ValidateBandwidth(req.Config.Bandwidth)
+			if err != nil {
+				_ = response.BadRequest(err).Render(w)
+
+				return
+			}
+
+			if req.Config.Retention.Applications < 0 || req.Config.Retention.OS < 0 {
+				_ = response.BadRequest(errors.New("image retention can't be negative")).Render(w)
+
+				return
+			}
+
+			if req.Config.PeerCache.Enabled || req.Config.PeerCache.Address != "" {
+				_, err = providers.PeerCacheAddress(req.Config.PeerCache.Address)
+				if err != nil {
+					_ = response.BadRequest(err).Render(w)
+
+					return
+				}
+			}
+		}
+
+		switch req.Action {
+		case "", "check":
+		case "apply":
+			if !s.state.OS.PendingReboot {
+				_ = response.BadRequest(errors.New("no staged OS update to apply")).Render(w)
+
+				return
+			}
+
+		default:
+			_ = response.BadRequest(fmt.Errorf("unknown action %q", req.Action)).Render(w)
+
+			return
+		}
+
+		// Apply the new configuration.
+		if req.Config != nil {
+			// Newly pinned releases get retried even if they previously failed.
+			if req.Config.OS.Version != s.state.System.Update.Config.OS.Version {
+				s.state.System.Update.State.FailedOSReleases = clearFailedRelease(s.state.System.Update.State.FailedOSReleases, req.Config.OS.Version)
+			}
+
+			for appName, policy := range req.Config.Applications {
+				if policy.Version != s.state.System.Update.Config.Applications[appName].Version && s.state.System.Update.State.FailedApplicationReleases != nil {
+					s.state.System.Update.State.FailedApplicationReleases[appName] = clearFailedRelease(s.state.System.Update.State.FailedApplicationReleases[appName], policy.Version)
+				}
+			}
+
+			s.state.System.Update.Config = *req.Config
+
+			err = s.state.Save(r.Context())
+			if err != nil {
+				_ = response.InternalError(err).Render(w)
+
+				return
+			}
+		}
+
+		switch req.Action {
+		case "apply":
+			// Reboot into the staged OS update.
+			slog.Info("Rebooting into OS update", "release", s.state.OS.NextRelease)
+
+			err = s.state.AddHistory(api.SystemHistoryEntry{
+				Type:        api.SystemHistoryTypeReboot,
+				Outcome:     api.SystemHistoryOutcomeSuccess,
+				Component:   s.state.OS.Name,
+				FromVersion: s.state.OS.RunningRelease,
+				ToVersion:   s.state.OS.NextRelease,
+				Message:     "Applying staged OS update",
+			})
+			if err != nil {
+				slog.Error("Failed to record history", "err", err.Error())
+			}
+
+			select {
+			case s.state.TriggerReboot <- nil:
+			default:
+			}
+
+		case "check":
+			// Check for updates, also applying any new pin right away.
+			select {
+			case s.state.TriggerUpdate <- true:
+			default:
+			}
+		}
+
+		_ = response.EmptySyncResponse.Render(w)
+	default:
+		// If none of the supported methods, return NotImplemented.
+		_ = response.NotImplemented(nil).Render(w)
+	}
+}
+
+// updateDryRun asks the configured providers for the available OS and application releases
+// and reports what an update check would do with them.
+func (s *Server) updateDryRun(ctx context.Context) (*api.SystemUpdateDryRun, error) {
+	// Use the providers of the daemon, sharing their release cache.
+	ps := s.providers
+	if len(ps) == 0 {
+		return nil, errors.New("no update provider is available")
+	}
+
+	resp := &api.SystemUpdateDryRun{
+		Applications: map[string]api.SystemUpdateDryRunComponent{},
+	}
+
+	var err error
+
+	// Check the OS.
+	resp.OS, err = s.dryRunOSUpdate(ctx, ps)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the installed applications.
+	for appName := range s.state.Applications {
+		resp.Applications[appName], err = s.dryRunAppUpdate(ctx, ps, appName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// dryRunOSUpdate reports what an update check would do for the OS.
+func (s *Server) dryRunOSUpdate(ctx context.Context, ps []providers.Provider) (api.SystemUpdateDryRunComponent, error) {
+	policy := s.state.System.Update.Config.OS
+	resp := api.SystemUpdateDryRunComponent{
+		CurrentVersion: s.state.OS.RunningRelease,
+		RebootRequired: s.state.OS.PendingReboot,
+	}
+
+	// Get the available release, trying each provider in turn.
+	var update providers.OSUpdate
+
+	var err error
+
+	for _, p := range ps {
+		update, err = p.GetOSUpdate(ctx, s.state.OS.Name, policy.Version)
+		if err == nil {
+			resp.Provider = p.Type()
+
+			break
+		}
+
+		if !providers.IsUnavailable(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		if errors.Is(err, providers.ErrNoUpdateAvailable) || providers.IsUnavailable(err) {
+			return resp, nil
+		}
+
+		return resp, err
+	}
+
+	resp.AvailableVersion = update.Version()
+
+	// Apply the same rules as the update check.
+	switch {
+	case policy.Hold:
+		resp.SkippedReason = "held"
+
+	case policy.Version == "" && !s.state.OS.PendingReboot && s.state.OS.NextRelease != "" && !providers.SameVersion(s.state.OS.RunningRelease, s.state.OS.NextRelease) && providers.SameVersion(s.state.OS.NextRelease, update.Version()):
+		resp.SkippedReason = "problematic"
+
+	case slices.ContainsFunc(s.state.System.Update.State.FailedOSReleases, func(release string) bool { return providers.SameVersion(release, update.Version()) }):
+		resp.SkippedReason = "problematic"
+
+	case providers.SameVersion(update.Version(), s.state.OS.RunningRelease) || providers.SameVersion(update.Version(), s.state.OS.NextRelease):
+		// Already installed.
+
+	default:
+		if policy.Version == "" {
+			isNewer, err := update.IsNewerThan(s.state.OS.RunningRelease)
+			if err != nil {
+				return resp, err
+			}
+
+			if !isNewer {
+				resp.SkippedReason = "older than local"
+
+				return resp, nil
+			}
+		}
+
+		resp.DownloadSize, err = update.DownloadSize(ctx, s.state.OS.Name)
+		if err != nil {
+			return resp, err
+		}
+
+		resp.Update = true
+		resp.RebootRequired = true
+	}
+
+	return resp, nil
+}
+
+// dryRunAppUpdate reports what an update check would do for an installed application.
+func (s *Server) dryRunAppUpdate(ctx context.Context, ps []providers.Provider, appName string) (api.SystemUpdateDryRunComponent, error) {
+	policy := s.state.System.Update.Config.Applications[appName]
+	resp := api.SystemUpdateDryRunComponent{
+		CurrentVersion: s.state.Applications[appName].Version,
+	}
+
+	// Get the available release, trying each provider in turn.
+	var app providers.Application
+
+	var err error
+
+	for _, p := range ps {
+		app, err = p.GetApplication(ctx, appName, policy.Version)
+		if err == nil {
+			resp.Provider = p.Type()
+
+			break
+		}
+
+		if !providers.IsUnavailable(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		if errors.Is(err, providers.ErrNoUpdateAvailable) || providers.IsUnavailable(err) {
+			return resp, nil
+		}
+
+		return resp, err
+	}
+
+	resp.AvailableVersion = app.Version()
+
+	// Apply the same rules as the update check.
+	switch {
+	case policy.Hold && resp.CurrentVersion != "":
+		resp.SkippedReason = "held"
+
+	case slices.ContainsFunc(s.state.System.Update.State.FailedApplicationReleases[appName], func(release string) bool { return providers.SameVersion(release, app.Version()) }):
+		resp.SkippedReason = "problematic"
+
+	case providers.SameVersion(app.Version(), resp.CurrentVersion):
+		// Already installed.
+
+	default:
+		if policy.Version == "" && resp.CurrentVersion != "" {
+			isNewer, err := app.IsNewerThan(resp.CurrentVersion)
+			if err != nil {
+				return resp, err
+			}
+
+			if !isNewer {
+				resp.SkippedReason = "older than local"
+
+				return resp, nil
+			}
+		}
+
+		resp.DownloadSize, err = app.DownloadSize(ctx)
+		if err != nil {
+			return resp, err
+		}
+
+		resp.Update = true
+	}
+
+	return resp, nil
+}
+
+// clearFailedRelease removes a pinned version from a list of failed releases.
+func clearFailedRelease(failed []string, version string) []string {
+	if version == "" {
+		return failed
+	}
+
+	return slices.DeleteFunc(failed, func(release string) bool { return providers.SameVersion(release, version) })
+}
+
+// validateUpdatePolicy checks that a pinned version can be parsed and isn't combined with a hold.
+func validateUpdatePolicy(name string, policy api.SystemUpdatePolicy) error {
+	if policy.Version == "" {
+		return nil
+	}
+
+	if policy.Hold {
+		return fmt.Errorf("%s can't be both held and pinned to a version", name)
+	}
+
+	_, err := providers.ParseVersion(policy.Version)
+	if err != nil {
+		return fmt.Errorf("bad pinned version for %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (s *Server) apiSystemUpdateBundle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		// If none of the supported methods, return NotImplemented.
+		_ = response.NotImplemented(nil).Render(w)
+
+		return
+	}
+
+	// Bundles can be large, don't time out the upload.
+	_ = http.NewResponseController(w).SetReadDeadline(time.Time{})
+
+	// Validate and stage the bundle.
+	version, err := providers.ImportBundle(r.Context(), r.Body)
+	if err != nil {
+		if errors.Is(err, providers.ErrBundleInUse) {
+			_ = response.Conflict(err).Render(w)
+
+			return
+		}
+
+		if errors.Is(err, providers.ErrInvalidBundle) {
+			_ = response.BadRequest(err).Render(w)
+
+			return
+		}
+
+		_ = response.InternalError(err).Render(w)
+
+		return
+	}
+
+	slog.Info("Received update bundle", "release", version)
+
+	// Apply the bundle, unless already queued.
+	select {
+	case s.state.TriggerBundleUpdate <- true:
+	default:
+	}
+
+	_ = response.EmptySyncResponse.Render(w)
+}
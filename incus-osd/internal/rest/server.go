@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/lxc/incus-os/incus-osd/internal/providers"
 	"github.com/lxc/incus-os/incus-osd/internal/state"
 )
 
@@ -15,14 +16,18 @@ import (
 type Server struct {
 	socketPath string
 	state      *state.State
+
+	// The update providers used by the daemon, configured one first.
+	providers []providers.Provider
 }
 
 // NewServer returns a REST API server object.
-func NewServer(_ context.Context, s *state.State, socketPath string) (*Server, error) {
+func NewServer(_ context.Context, s *state.State, socketPath string, ps []providers.Provider) (*Server, error) {
 	// Define the struct.
 	server := Server{
 		socketPath: socketPath,
 		state:      s,
+		providers:  ps,
 	}
 
 	// Create runtime path if missing.
@@ -54,7 +59,11 @@ func (s *Server) Serve(_ context.Context) error {
 	router.HandleFunc("/1.0/services/{name}", s.apiServicesEndpoint)
 	router.HandleFunc("/1.0/system", s.apiSystem)
 	router.HandleFunc("/1.0/system/encryption", s.apiSystemEncryption)
+	router.HandleFunc("/1.0/system/history", s.apiSystemHistory)
 	router.HandleFunc("/1.0/system/network", s.apiSystemNetwork)
+	router.HandleFunc("/1.0/system/provider", s.apiSystemProvider)
+	router.HandleFunc("/1.0/system/update", s.apiSystemUpdate)
+	router.HandleFunc("/1.0/system/update/bundle", s.apiSystemUpdateBundle)
 
 	// Setup server.
 	server := &http.Server{
@@ -0,0 +1,149 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/lxc/incus-os/incus-osd/api"
+)
+
+// HistoryMaxEntries is the number of history entries kept, older ones being dropped.
+var HistoryMaxEntries = 1000
+
+// historyPath returns the path of the history file, stored next to the state file.
+func (s *State) historyPath() string {
+	return filepath.Join(filepath.Dir(s.path), "history.jsonl")
+}
+
+// loadHistory reads the history file into memory if not already done. The caller must hold historyMu.
+func (s *State) loadHistory() error {
+	if s.history != nil {
+		return nil
+	}
+
+	s.history = []api.SystemHistoryEntry{}
+
+	body, err := os.ReadFile(s.historyPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	corrupted := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		entry := api.SystemHistoryEntry{}
+
+		// Skip any partially written entry.
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			corrupted = true
+
+			continue
+		}
+
+		s.history = append(s.history, entry)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return err
+	}
+
+	// Drop partially written entries from disk so new ones can safely be appended.
+	if corrupted {
+		return s.writeHistory()
+	}
+
+	return nil
+}
+
+// AddHistory appends an entry to the update and lifecycle history, dropping the oldest
+// entries once more than HistoryMaxEntries are recorded.
+func (s *State) AddHistory(entry api.SystemHistoryEntry) error {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+
+	err := s.loadHistory()
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.history = append(s.history, entry)
+
+	// Rewrite the whole file once it grows past its limit.
+	if len(s.history) > HistoryMaxEntries {
+		s.history = slices.Clone(s.history[len(s.history)-HistoryMaxEntries:])
+
+		return s.writeHistory()
+	}
+
+	// Otherwise simply append the new entry.
+	fd, err := os.OpenFile(s.historyPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	defer fd.Close()
+
+	_, err = fd.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+
+	return fd.Close()
+}
+
+// writeHistory atomically replaces the history file with the in-memory entries. The caller must hold historyMu.
+func (s *State) writeHistory() error {
+	buf := &bytes.Buffer{}
+
+	for _, entry := range s.history {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	err := os.WriteFile(s.historyPath()+".tmp", buf.Bytes(), 0o600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(s.historyPath()+".tmp", s.historyPath())
+}
+
+// GetHistory returns the recorded history, oldest entry first.
+func (s *State) GetHistory() ([]api.SystemHistoryEntry, error) {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	err := s.loadHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Clone(s.history), nil
+}
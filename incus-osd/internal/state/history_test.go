@@ -0,0 +1,70 @@
+package state
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lxc/incus-os/incus-osd/api"
+)
+
+func TestHistory(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	maxEntries := HistoryMaxEntries
+	HistoryMaxEntries = 3
+	t.Cleanup(func() { HistoryMaxEntries = maxEntries })
+
+	s, err := LoadOrCreate(ctx, filepath.Join(tmpDir, "state.json"))
+	require.NoError(t, err)
+
+	// An empty history.
+	entries, err := s.GetHistory()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// Record a few entries.
+	for _, version := range []string{"1", "2", "3", "4"} {
+		err = s.AddHistory(api.SystemHistoryEntry{Type: api.SystemHistoryTypeOSUpdate, Outcome: api.SystemHistoryOutcomeSuccess, ToVersion: version})
+		require.NoError(t, err)
+	}
+
+	// Only the latest entries are kept, both in memory and on disk.
+	entries, err = s.GetHistory()
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, "2", entries[0].ToVersion)
+	require.Equal(t, "4", entries[2].ToVersion)
+	require.False(t, entries[2].Timestamp.IsZero())
+
+	// Partial entries are skipped when loading the history.
+	fd, err := os.OpenFile(filepath.Join(tmpDir, "history.jsonl"), os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = fd.WriteString(`{"type": "reb`)
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+
+	s, err = LoadOrCreate(ctx, filepath.Join(tmpDir, "state.json"))
+	require.NoError(t, err)
+
+	entries, err = s.GetHistory()
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, "4", entries[2].ToVersion)
+
+	// New entries can still be recorded.
+	err = s.AddHistory(api.SystemHistoryEntry{Type: api.SystemHistoryTypeReboot, Outcome: api.SystemHistoryOutcomeSuccess})
+	require.NoError(t, err)
+
+	s, err = LoadOrCreate(ctx, filepath.Join(tmpDir, "state.json"))
+	require.NoError(t, err)
+
+	entries, err = s.GetHistory()
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, api.SystemHistoryTypeReboot, entries[2].Type)
+}
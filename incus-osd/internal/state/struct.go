@@ -1,6 +1,8 @@
 package state
 
 import (
+	"sync"
+
 	"github.com/lxc/incus-os/incus-osd/api"
 )
 
@@ -8,6 +10,12 @@ import (
 type Application struct {
 	Initialized bool   `json:"initialized"`
 	Version     string `json:"version"`
+
+	// PreviousVersion is the release kept around to roll back the last update.
+	PreviousVersion string `json:"previous_version,omitempty"`
+
+	// Evacuated is set while the application is evacuated ahead of a reboot or shutdown.
+	Evacuated bool `json:"evacuated,omitempty"`
 }
 
 // OS represents the current OS image state.
@@ -15,18 +23,26 @@ type OS struct {
 	Name           string `json:"name"`
 	RunningRelease string `json:"running_release"`
 	NextRelease    string `json:"next_release"`
+
+	// PendingReboot is set once an OS update was applied and until it's booted into.
+	PendingReboot bool `json:"pending_reboot,omitempty"`
 }
 
 // State represents the on-disk persistent state.
 type State struct {
 	path string
 
+	// In-memory copy of the update and lifecycle history.
+	history   []api.SystemHistoryEntry
+	historyMu sync.Mutex
+
 	ShouldPerformInstall bool `json:"-"`
 
 	// Triggers for daemon actions.
-	TriggerReboot   chan error `json:"-"`
-	TriggerShutdown chan error `json:"-"`
-	TriggerUpdate   chan bool  `json:"-"`
+	TriggerReboot       chan error `json:"-"`
+	TriggerShutdown     chan error `json:"-"`
+	TriggerUpdate       chan bool  `json:"-"`
+	TriggerBundleUpdate chan bool  `json:"-"`
 
 	Applications map[string]Application `json:"applications"`
 
@@ -43,5 +59,6 @@ type State struct {
 		Encryption api.SystemEncryption `json:"encryption"`
 		Network    api.SystemNetwork    `json:"network"`
 		Provider   api.SystemProvider   `json:"provider"`
+		Update     api.SystemUpdate     `json:"update"`
 	} `json:"system"`
 }
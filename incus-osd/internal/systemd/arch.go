@@ -0,0 +1,75 @@
+package systemd
+
+import (
+	"errors"
+
+	"github.com/lxc/incus/v6/shared/osarch"
+)
+
+// ErrUnsupportedArchitecture is returned when running on an architecture IncusOS isn't built for.
+var ErrUnsupportedArchitecture = errors.New("unsupported architecture")
+
+// Architecture describes an architecture IncusOS is built for.
+type Architecture struct {
+	// Name of the architecture as used by systemd, in partition labels and OS update file names.
+	Name string
+
+	// GPT partition type GUIDs of the architecture specific partitions.
+	RootPartitionType         string
+	USRPartitionType          string
+	USRVerityPartitionType    string
+	USRVeritySigPartitionType string
+}
+
+// architectures lists the supported architectures, keyed by their osarch identifier.
+var architectures = map[int]Architecture{
+	osarch.ARCH_64BIT_INTEL_X86: {
+		Name:                      "x86-64",
+		RootPartitionType:         "4F68BCE3-E8CD-4DB1-96E7-FBCAF984B709",
+		USRPartitionType:          "8484680C-9521-48C6-9C11-B0720656F69E",
+		USRVerityPartitionType:    "77FF5F63-E7B6-4633-ACF4-1565B864C0E6",
+		USRVeritySigPartitionType: "E7BB33FB-06CF-4E81-8273-E543B413E2E2",
+	},
+	osarch.ARCH_64BIT_ARMV8_LITTLE_ENDIAN: {
+		Name:                      "arm64",
+		RootPartitionType:         "B921B045-1DF0-41C3-AF44-4C6F280D3FAE",
+		USRPartitionType:          "B0E01050-EE5F-4390-949A-9101B17104E9",
+		USRVerityPartitionType:    "6E11A4E7-FBCA-4DED-B9E9-E1A512BB664E",
+		USRVeritySigPartitionType: "C23CE4FF-44BD-4B00-B2D4-B41B3419E02A",
+	},
+}
+
+// GetArchitecture returns the local architecture.
+func GetArchitecture() (Architecture, error) {
+	archID, err := osarch.ArchitectureGetLocalID()
+	if err != nil {
+		return Architecture{}, err
+	}
+
+	arch, ok := architectures[archID]
+	if !ok {
+		return Architecture{}, ErrUnsupportedArchitecture
+	}
+
+	return arch, nil
+}
+
+// ArchitectureNames returns the systemd names of all the supported architectures.
+func ArchitectureNames() []string {
+	names := make([]string, 0, len(architectures))
+	for _, arch := range architectures {
+		names = append(names, arch.Name)
+	}
+
+	return names
+}
+
+// RootPartitionPath returns the path of the root partition of the local architecture.
+func RootPartitionPath() (string, error) {
+	arch, err := GetArchitecture()
+	if err != nil {
+		return "", err
+	}
+
+	return "/dev/disk/by-partlabel/root-" + arch.Name, nil
+}
@@ -0,0 +1,75 @@
+package systemd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lxc/incus/v6/shared/subprocess"
+)
+
+// BootAssessment is the boot counting status of the current boot, as reported by systemd-bless-boot.
+type BootAssessment string
+
+const (
+	// BootAssessmentGood is used when the boot was already marked as good.
+	BootAssessmentGood BootAssessment = "good"
+
+	// BootAssessmentBad is used when the boot was already marked as bad.
+	BootAssessmentBad BootAssessment = "bad"
+
+	// BootAssessmentIndeterminate is used when the boot still needs to be marked as good or bad.
+	BootAssessmentIndeterminate BootAssessment = "indeterminate"
+
+	// BootAssessmentClean is used when boot counting isn't in use for the current boot.
+	BootAssessmentClean BootAssessment = "clean"
+)
+
+// GetBootAssessment returns the boot counting status of the current boot.
+func GetBootAssessment(ctx context.Context) (BootAssessment, error) {
+	output, err := subprocess.RunCommandContext(ctx, "/usr/lib/systemd/systemd-bless-boot", "status")
+	if err != nil {
+		return "", err
+	}
+
+	return BootAssessment(strings.TrimSpace(output)), nil
+}
+
+// MarkBootGood marks the current boot as good, so the boot loader keeps using it.
+func MarkBootGood(ctx context.Context) error {
+	// Allow systemd-bless-boot to run.
+	err := os.WriteFile(SystemdBootHealthyPath, nil, 0o600)
+	if err != nil {
+		return err
+	}
+
+	return StartUnit(ctx, "systemd-bless-boot.service")
+}
+
+// MarkBootBad marks the current boot as bad, so the boot loader falls back to the previous image.
+func MarkBootBad(ctx context.Context) error {
+	_, err := subprocess.RunCommandContext(ctx, "/usr/lib/systemd/systemd-bless-boot", "bad")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IsBootFailed returns whether the boot loader gave up on the image of an OS release, either because it
+// was marked as bad or because it ran out of boot attempts. Its entry is then named "<os>_<release>+0[-<done>].efi".
+func IsBootFailed(_ context.Context, osName string, release string) (bool, error) {
+	for _, pattern := range []string{osName + "_" + release + "+0.efi", osName + "_" + release + "+0-*.efi"} {
+		matches, err := filepath.Glob(filepath.Join(SystemBootEntriesPath, pattern))
+		if err != nil {
+			return false, err
+		}
+
+		if len(matches) > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
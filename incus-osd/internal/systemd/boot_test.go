@@ -0,0 +1,32 @@
+package systemd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsBootFailed(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	SystemBootEntriesPath = t.TempDir()
+
+	for _, name := range []string{"IncusOS_1.efi", "IncusOS_2+1-2.efi", "IncusOS_3+0-3.efi", "IncusOS_4+0.efi", "IncusOS_5+3.efi"} {
+		require.NoError(t, os.WriteFile(filepath.Join(SystemBootEntriesPath, name), nil, 0o600))
+	}
+
+	for release, expected := range map[string]bool{
+		"1": false, // Blessed.
+		"2": false, // Attempts left.
+		"3": true,  // Out of attempts.
+		"4": true,  // Marked bad before any attempt got recorded.
+		"5": false, // Not booted yet.
+		"6": false, // Missing.
+	} {
+		failed, err := IsBootFailed(ctx, "IncusOS", release)
+		require.NoError(t, err)
+		require.Equal(t, expected, failed, release)
+	}
+}
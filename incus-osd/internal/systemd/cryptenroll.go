@@ -15,7 +15,12 @@ import (
 // GenerateRecoveryKey utilizes systemd-cryptenroll to generate a recovery key for the
 // root LUKS volume. Depends on an existing tpm2-backed key being enrolled and accessible.
 func GenerateRecoveryKey(ctx context.Context, s *state.State) error {
-	output, err := subprocess.RunCommandContext(ctx, "systemd-cryptenroll", "--unlock-tpm2-device", "auto", "--recovery-key", "/dev/disk/by-partlabel/root-x86-64")
+	rootPartition, err := RootPartitionPath()
+	if err != nil {
+		return err
+	}
+
+	output, err := subprocess.RunCommandContext(ctx, "systemd-cryptenroll", "--unlock-tpm2-device", "auto", "--recovery-key", rootPartition)
 	if err != nil {
 		return err
 	}
@@ -33,8 +38,13 @@ func AddEncryptionKey(ctx context.Context, s *state.State, key string) error {
 		return errors.New("provided encryption key is already enrolled")
 	}
 
+	rootPartition, err := RootPartitionPath()
+	if err != nil {
+		return err
+	}
+
 	// Add the new encryption password. Need to pass to systemd-cryptenroll via NEWPASSWORD environment variable.
-	_, _, err := subprocess.RunCommandSplit(ctx, append(os.Environ(), "NEWPASSWORD="+key), nil, "systemd-cryptenroll", "--unlock-tpm2-device", "auto", "--password", "/dev/disk/by-partlabel/root-x86-64")
+	_, _, err = subprocess.RunCommandSplit(ctx, append(os.Environ(), "NEWPASSWORD="+key), nil, "systemd-cryptenroll", "--unlock-tpm2-device", "auto", "--password", rootPartition)
 	if err != nil {
 		return err
 	}
@@ -53,8 +63,13 @@ func DeleteEncryptionKey(ctx context.Context, s *state.State, key string) error
 		return errors.New("provided encryption key is not enrolled")
 	}
 
+	rootPartition, err := RootPartitionPath()
+	if err != nil {
+		return err
+	}
+
 	// First, wipe all recovery and password slots.
-	_, err := subprocess.RunCommandContext(ctx, "systemd-cryptenroll", "--unlock-tpm2-device", "auto", "--wipe-slot", "recovery,password", "/dev/disk/by-partlabel/root-x86-64")
+	_, err = subprocess.RunCommandContext(ctx, "systemd-cryptenroll", "--unlock-tpm2-device", "auto", "--wipe-slot", "recovery,password", rootPartition)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,404 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lxc/incus-os/incus-osd/api"
+)
+
+// ErrImageNotRetained is returned when restoring an image version which isn't in the image store.
+var ErrImageNotRetained = errors.New("image version isn't retained")
+
+// ErrInvalidImageVersion is returned for versions which can't safely be used as image store file names.
+var ErrInvalidImageVersion = errors.New("invalid image version")
+
+// retainedImage is a version held in the image store.
+type retainedImage struct {
+	version string
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// validateImageVersion checks that a version can be used as a file name within the image store.
+func validateImageVersion(version string) error {
+	if version == "" || strings.HasPrefix(version, ".") || strings.ContainsAny(version, `/\`) {
+		return fmt.Errorf("%w %q", ErrInvalidImageVersion, version)
+	}
+
+	return nil
+}
+
+// extensionImagesPath returns the image store directory of a system extension.
+func extensionImagesPath(name string) string {
+	return filepath.Join(SystemImagesPath, "extensions", name)
+}
+
+// osImagesPath returns the image store directory of the OS releases.
+func osImagesPath() string {
+	return filepath.Join(SystemImagesPath, "os")
+}
+
+// RetainExtension keeps the current image of a system extension in the image store under the provided version.
+func RetainExtension(_ context.Context, name string, version string) error {
+	err := validateImageVersion(version)
+	if err != nil {
+		return err
+	}
+
+	currentPath := filepath.Join(SystemExtensionsPath, name+".raw")
+	retainedPath := filepath.Join(extensionImagesPath(name), version+".raw")
+
+	// Nothing to keep on first install.
+	_, err = os.Stat(currentPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	err = os.MkdirAll(extensionImagesPath(name), 0o700)
+	if err != nil {
+		return err
+	}
+
+	// Hardlink the image, as updates replace the file rather than modifying it.
+	_ = os.Remove(retainedPath)
+
+	return os.Link(currentPath, retainedPath)
+}
+
+// RestoreExtension puts a retained image of a system extension back in place.
+// The extensions must then be refreshed for it to be used.
+func RestoreExtension(_ context.Context, name string, version string) error {
+	if version == "" {
+		return ErrImageNotRetained
+	}
+
+	err := validateImageVersion(version)
+	if err != nil {
+		return err
+	}
+
+	retainedPath := filepath.Join(extensionImagesPath(name), version+".raw")
+
+	_, err = os.Stat(retainedPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrImageNotRetained
+		}
+
+		return err
+	}
+
+	// Link the image next to its final location, then atomically move it into place.
+	tmpPath := filepath.Join(SystemExtensionsPath, "."+name+".raw.tmp")
+
+	_ = os.Remove(tmpPath)
+
+	err = os.Link(retainedPath, tmpPath)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, filepath.Join(SystemExtensionsPath, name+".raw"))
+}
+
+// RetainOSUpdate keeps the downloaded files of an OS update in the image store.
+func RetainOSUpdate(_ context.Context, version string) error {
+	err := validateImageVersion(version)
+	if err != nil {
+		return err
+	}
+
+	retainedPath := filepath.Join(osImagesPath(), version)
+
+	entries, err := os.ReadDir(SystemUpdatesPath)
+	if err != nil {
+		return err
+	}
+
+	// Replace any previous copy.
+	err = os.RemoveAll(retainedPath)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(retainedPath, 0o700)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		err = os.Link(filepath.Join(SystemUpdatesPath, entry.Name()), filepath.Join(retainedPath, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RestoreOSUpdate puts the retained files of an OS update back in place, so it can be applied without downloading it.
+func RestoreOSUpdate(_ context.Context, version string) error {
+	if version == "" {
+		return ErrImageNotRetained
+	}
+
+	err := validateImageVersion(version)
+	if err != nil {
+		return err
+	}
+
+	retainedPath := filepath.Join(osImagesPath(), version)
+
+	entries, err := os.ReadDir(retainedPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrImageNotRetained
+		}
+
+		return err
+	}
+
+	// Clear the target path.
+	err = os.RemoveAll(SystemUpdatesPath)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(SystemUpdatesPath, 0o700)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err = os.Link(filepath.Join(retainedPath, entry.Name()), filepath.Join(SystemUpdatesPath, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetRetainedOSFile returns the path of the file of a retained OS update matching the provided glob pattern.
+func GetRetainedOSFile(_ context.Context, version string, pattern string) (string, error) {
+	if version == "" {
+		return "", ErrImageNotRetained
+	}
+
+	err := validateImageVersion(version)
+	if err != nil {
+		return "", err
+	}
+
+	matches, err := filepath.Glob(filepath.Join(osImagesPath(), version, pattern))
+	if err != nil {
+		return "", err
+	}
+
+	if len(matches) != 1 {
+		return "", ErrImageNotRetained
+	}
+
+	return matches[0], nil
+}
+
+// PruneExtensions removes the images of system extensions which aren't installed anymore and only
+// keeps the newest images of the others. The provided versions of each installed extension are always kept.
+// Only extensions present in the image store are considered, other system extensions are left untouched.
+func PruneExtensions(_ context.Context, installed map[string][]string, keep int) error {
+	entries, err := os.ReadDir(filepath.Join(SystemImagesPath, "extensions"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, entry := range entries {
+		versions, isInstalled := installed[entry.Name()]
+		if !isInstalled {
+			// Remove the active image along with the retained ones.
+			err = os.Remove(filepath.Join(SystemExtensionsPath, entry.Name()+".raw"))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+
+			err = os.RemoveAll(extensionImagesPath(entry.Name()))
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		images, err := listRetainedImages(extensionImagesPath(entry.Name()), ".raw")
+		if err != nil {
+			return err
+		}
+
+		err = pruneImages(images, keep, versions)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PruneOSUpdates only keeps the newest OS updates in the image store.
+func PruneOSUpdates(_ context.Context, keep int) error {
+	images, err := listRetainedImages(osImagesPath(), "")
+	if err != nil {
+		return err
+	}
+
+	return pruneImages(images, keep, nil)
+}
+
+// GetRetainedImages returns the retained images of each system extension and of the OS.
+func GetRetainedImages(_ context.Context) (map[string][]api.SystemUpdateRetainedImage, []api.SystemUpdateRetainedImage, error) {
+	extensions := map[string][]api.SystemUpdateRetainedImage{}
+
+	entries, err := os.ReadDir(filepath.Join(SystemImagesPath, "extensions"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	for _, entry := range entries {
+		images, err := listRetainedImages(extensionImagesPath(entry.Name()), ".raw")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		extensions[entry.Name()] = toAPIImages(images)
+	}
+
+	images, err := listRetainedImages(osImagesPath(), "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return extensions, toAPIImages(images), nil
+}
+
+// listRetainedImages returns the images held in an image store directory, newest first.
+// Versions are either files with the provided suffix or, without a suffix, directories.
+func listRetainedImages(path string, suffix string) ([]retainedImage, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	images := []retainedImage{}
+
+	for _, entry := range entries {
+		version, ok := strings.CutSuffix(entry.Name(), suffix)
+		if !ok || (suffix == "") != entry.IsDir() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		image := retainedImage{
+			version: version,
+			path:    filepath.Join(path, entry.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		}
+
+		// Add up the files of directories.
+		if entry.IsDir() {
+			files, err := os.ReadDir(image.path)
+			if err != nil {
+				return nil, err
+			}
+
+			image.size = 0
+
+			for _, file := range files {
+				fileInfo, err := file.Info()
+				if err != nil {
+					return nil, err
+				}
+
+				image.size += fileInfo.Size()
+			}
+		}
+
+		images = append(images, image)
+	}
+
+	slices.SortFunc(images, func(a retainedImage, b retainedImage) int {
+		return b.modTime.Compare(a.modTime)
+	})
+
+	return images, nil
+}
+
+// pruneImages removes all but the newest images, never removing the protected versions.
+func pruneImages(images []retainedImage, keep int, protected []string) error {
+	// Protected versions count towards the images kept.
+	kept := 0
+
+	for _, image := range images {
+		if slices.Contains(protected, image.version) {
+			kept++
+		}
+	}
+
+	for _, image := range images {
+		if slices.Contains(protected, image.version) {
+			continue
+		}
+
+		kept++
+		if kept <= keep {
+			continue
+		}
+
+		err := os.RemoveAll(image.path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// toAPIImages converts retained images to their API representation.
+func toAPIImages(images []retainedImage) []api.SystemUpdateRetainedImage {
+	ret := make([]api.SystemUpdateRetainedImage, 0, len(images))
+
+	for _, image := range images {
+		ret = append(ret, api.SystemUpdateRetainedImage{
+			Version: image.version,
+			Size:    image.size,
+		})
+	}
+
+	return ret
+}
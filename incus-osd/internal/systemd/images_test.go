@@ -0,0 +1,177 @@
+package systemd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// installTestExtension replaces the active image of an extension, like an update would.
+func installTestExtension(t *testing.T, name string, content string, modTime time.Time) {
+	t.Helper()
+
+	tmpPath := filepath.Join(t.TempDir(), name+".raw")
+	require.NoError(t, os.WriteFile(tmpPath, []byte(content), 0o600))
+	require.NoError(t, os.Chtimes(tmpPath, modTime, modTime))
+	require.NoError(t, os.Rename(tmpPath, filepath.Join(SystemExtensionsPath, name+".raw")))
+}
+
+func TestRetainExtension(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	SystemExtensionsPath = filepath.Join(tmpDir, "extensions")
+	SystemImagesPath = filepath.Join(tmpDir, "images")
+
+	require.NoError(t, os.MkdirAll(SystemExtensionsPath, 0o700))
+
+	// Nothing to keep on first install.
+	require.NoError(t, RetainExtension(ctx, "incus", "1"))
+	require.ErrorIs(t, RestoreExtension(ctx, "incus", "1"), ErrImageNotRetained)
+
+	// Keep the current image, then replace it like an update would.
+	installTestExtension(t, "incus", "old", time.Now().Add(-time.Hour))
+	require.NoError(t, RetainExtension(ctx, "incus", "1"))
+
+	installTestExtension(t, "incus", "new", time.Now())
+	require.NoError(t, RetainExtension(ctx, "incus", "2"))
+
+	// Roll back.
+	require.NoError(t, RestoreExtension(ctx, "incus", "1"))
+
+	data, err := os.ReadFile(filepath.Join(SystemExtensionsPath, "incus.raw"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("old"), data)
+
+	// Both versions are still retained.
+	extensions, osImages, err := GetRetainedImages(ctx)
+	require.NoError(t, err)
+	require.Empty(t, osImages)
+	require.Len(t, extensions["incus"], 2)
+	require.Equal(t, "2", extensions["incus"][0].Version)
+	require.Equal(t, int64(3), extensions["incus"][0].Size)
+
+	require.ErrorIs(t, RestoreExtension(ctx, "incus", ""), ErrImageNotRetained)
+}
+
+func TestPruneExtensions(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	SystemExtensionsPath = filepath.Join(tmpDir, "extensions")
+	SystemImagesPath = filepath.Join(tmpDir, "images")
+
+	require.NoError(t, os.MkdirAll(SystemExtensionsPath, 0o700))
+
+	// Install a few versions of two applications.
+	for i, version := range []string{"1", "2", "3", "4"} {
+		installTestExtension(t, "incus", "incus"+version, time.Now().Add(time.Duration(i)*time.Minute))
+		require.NoError(t, RetainExtension(ctx, "incus", version))
+	}
+
+	installTestExtension(t, "debug", "debug", time.Now())
+	require.NoError(t, RetainExtension(ctx, "debug", "1"))
+
+	// An extension installed by hand, outside of the image store.
+	require.NoError(t, os.WriteFile(filepath.Join(SystemExtensionsPath, "custom.raw"), []byte("custom"), 0o600))
+
+	// Only keep the newest images of installed applications, along with the protected ones.
+	require.NoError(t, PruneExtensions(ctx, map[string][]string{"incus": {"4", "1"}}, 3))
+
+	extensions, _, err := GetRetainedImages(ctx)
+	require.NoError(t, err)
+	require.Len(t, extensions, 1)
+
+	versions := []string{}
+	for _, image := range extensions["incus"] {
+		versions = append(versions, image.Version)
+	}
+
+	require.Equal(t, []string{"4", "3", "1"}, versions)
+
+	// The removed application is gone.
+	_, err = os.Stat(filepath.Join(SystemExtensionsPath, "debug.raw"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = os.Stat(filepath.Join(SystemExtensionsPath, "incus.raw"))
+	require.NoError(t, err)
+
+	// Unknown extensions are left alone.
+	_, err = os.Stat(filepath.Join(SystemExtensionsPath, "custom.raw"))
+	require.NoError(t, err)
+}
+
+func TestRetainOSUpdate(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	SystemUpdatesPath = filepath.Join(tmpDir, "updates")
+	SystemImagesPath = filepath.Join(tmpDir, "images")
+
+	require.ErrorIs(t, RestoreOSUpdate(ctx, "1"), ErrImageNotRetained)
+
+	// Retain two updates.
+	for _, version := range []string{"1", "2"} {
+		require.NoError(t, os.RemoveAll(SystemUpdatesPath))
+		require.NoError(t, os.MkdirAll(SystemUpdatesPath, 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(SystemUpdatesPath, "IncusOS_"+version+".efi"), []byte("efi"), 0o600))
+		require.NoError(t, RetainOSUpdate(ctx, version))
+
+		modTime := time.Now().Add(-time.Hour)
+		if version == "2" {
+			modTime = time.Now()
+		}
+
+		require.NoError(t, os.Chtimes(filepath.Join(SystemImagesPath, "os", version), modTime, modTime))
+	}
+
+	// Put the first one back in place.
+	require.NoError(t, RestoreOSUpdate(ctx, "1"))
+
+	entries, err := os.ReadDir(SystemUpdatesPath)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "IncusOS_1.efi", entries[0].Name())
+
+	// Only keep the newest one.
+	require.NoError(t, PruneOSUpdates(ctx, 1))
+
+	_, osImages, err := GetRetainedImages(ctx)
+	require.NoError(t, err)
+	require.Len(t, osImages, 1)
+	require.Equal(t, "2", osImages[0].Version)
+	require.Equal(t, int64(3), osImages[0].Size)
+}
+
+func TestImageVersionValidation(t *testing.T) { //nolint:paralleltest
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	SystemExtensionsPath = filepath.Join(tmpDir, "extensions")
+	SystemImagesPath = filepath.Join(tmpDir, "images")
+	SystemUpdatesPath = filepath.Join(tmpDir, "updates")
+
+	require.NoError(t, os.MkdirAll(SystemExtensionsPath, 0o700))
+	require.NoError(t, os.MkdirAll(SystemUpdatesPath, 0o700))
+	installTestExtension(t, "incus", "current", time.Now())
+
+	// Versions must not escape the image store.
+	for _, version := range []string{"..", "../../extensions/incus", "1/2", `1\2`, ".hidden"} {
+		require.ErrorIs(t, RetainExtension(ctx, "incus", version), ErrInvalidImageVersion, version)
+		require.ErrorIs(t, RestoreExtension(ctx, "incus", version), ErrInvalidImageVersion, version)
+		require.ErrorIs(t, RetainOSUpdate(ctx, version), ErrInvalidImageVersion, version)
+		require.ErrorIs(t, RestoreOSUpdate(ctx, version), ErrInvalidImageVersion, version)
+
+		_, err := GetRetainedOSFile(ctx, version, "*")
+		require.ErrorIs(t, err, ErrInvalidImageVersion, version)
+	}
+
+	require.ErrorIs(t, RetainExtension(ctx, "incus", ""), ErrInvalidImageVersion)
+	require.ErrorIs(t, RetainOSUpdate(ctx, ""), ErrInvalidImageVersion)
+
+	// Nothing was touched.
+	data, err := os.ReadFile(filepath.Join(SystemExtensionsPath, "incus.raw"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("current"), data)
+	require.NoDirExists(t, SystemImagesPath)
+}
@@ -1,15 +1,25 @@
 package systemd
 
 var (
+	// SystemBootEntriesPath is where the boot loader entries (UKIs) of the OS images are installed.
+	SystemBootEntriesPath = "/boot/EFI/Linux"
+
 	// SystemExtensionsPath is the systemd location for system extensions.
 	SystemExtensionsPath = "/var/lib/extensions"
 
+	// SystemImagesPath holds the retained OS and system extension images, one per version.
+	SystemImagesPath = "/var/lib/incus-os/images"
+
 	// SystemUpdatesPath is the systemd location for system updates.
 	SystemUpdatesPath = "/var/lib/updates"
 
 	// SystemdNetworkConfigPath is the location for systemd network config files.
 	SystemdNetworkConfigPath = "/run/systemd/network/"
 
+	// SystemdBootHealthyPath is created once the system passed its health checks, allowing
+	// systemd-bless-boot to mark the boot as good.
+	SystemdBootHealthyPath = "/run/incus-os/boot-healthy"
+
 	// SystemdTimesyncConfigFile is the configuration file for systemd-timesyncd.
 	SystemdTimesyncConfigFile = "/run/systemd/timesyncd.conf"
 )
@@ -1,10 +1,17 @@
 package tui
 
+import (
+	"time"
+
+	"github.com/lxc/incus/v6/shared/units"
+)
+
 // Modal holds the information for a given modal dialog.
 type Modal struct {
 	title    string
 	message  string
 	progress float64
+	details  string
 	isDone   bool
 
 	t *TUI
@@ -20,6 +27,20 @@ func (m *Modal) Update(message string) {
 // UpdateProgress sets the current modal's progress, expressed as a float between 0 and 1.
 func (m *Modal) UpdateProgress(progress float64) {
 	m.progress = progress
+	m.details = ""
+
+	m.t.quickDraw()
+}
+
+// UpdateDownloadProgress sets the current modal's progress, expressed as a float between 0 and 1,
+// showing the download rate (in bytes per second) and estimated time remaining (if known) on the progress bar.
+func (m *Modal) UpdateDownloadProgress(progress float64, rate int64, eta time.Duration) {
+	m.progress = progress
+
+	m.details = units.GetByteSizeStringIEC(rate, 1) + "/s"
+	if eta >= 0 {
+		m.details += ", " + eta.String() + " remaining"
+	}
 
 	m.t.quickDraw()
 }
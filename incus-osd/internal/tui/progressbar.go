@@ -38,6 +38,9 @@ type ProgressBar struct {
 	// Progress required to fill the bar.
 	max int64
 
+	// Text displayed in the middle of the bar.
+	label string
+
 	sync.RWMutex
 }
 
@@ -112,6 +115,22 @@ func (p *ProgressBar) GetMax() int64 {
 	return p.max
 }
 
+// SetLabel sets the text displayed in the middle of the bar, such as the rate of a download.
+func (p *ProgressBar) SetLabel(label string) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.label = label
+}
+
+// GetLabel returns the text displayed in the middle of the bar.
+func (p *ProgressBar) GetLabel() string {
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.label
+}
+
 // AddProgress adds to the current progress.
 func (p *ProgressBar) AddProgress(progress int64) {
 	p.Lock()
@@ -191,4 +210,18 @@ func (p *ProgressBar) Draw(screen tcell.Screen) {
 			}
 		}
 	}
+
+	// Draw the label on top of the bar.
+	if p.label != "" && !p.vertical {
+		label := []rune(" " + p.label + " ")
+		start := x + max((width-len(label))/2, 0)
+
+		for i, r := range label {
+			if start+i >= x+width {
+				break
+			}
+
+			screen.SetContent(start+i, y+height/2, r, nil, tcell.StyleDefault.Foreground(tview.Styles.PrimitiveBackgroundColor).Background(tview.Styles.PrimaryTextColor))
+		}
+	}
 }
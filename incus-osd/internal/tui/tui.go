@@ -110,7 +110,7 @@ func (t *TUI) Run() error {
 			case numModals > 1:
 				// Cycle through each of the current modals.
 				modalIndex := i % numModals
-				t.renderModal(fmt.Sprintf("[%d/%d] %s", modalIndex+1, numModals, t.modalMessages[modalIndex].title), t.modalMessages[modalIndex].message, t.modalMessages[modalIndex].progress)
+				t.renderModal(fmt.Sprintf("[%d/%d] %s", modalIndex+1, numModals, t.modalMessages[modalIndex].title), t.modalMessages[modalIndex].message, t.modalMessages[modalIndex].progress, t.modalMessages[modalIndex].details)
 			case numModals == 1:
 				// No point in re-drawing anything when there's just one modal. Any updates to it
 				// will have already been drawn in `quickDraw()`.
@@ -167,7 +167,7 @@ func (t *TUI) quickDraw() {
 
 	if len(t.modalMessages) == 1 {
 		if !t.modalMessages[0].isDone {
-			t.renderModal(t.modalMessages[0].title, t.modalMessages[0].message, t.modalMessages[0].progress)
+			t.renderModal(t.modalMessages[0].title, t.modalMessages[0].message, t.modalMessages[0].progress, t.modalMessages[0].details)
 		} else {
 			t.pages.RemovePage("modal")
 		}
@@ -177,8 +177,8 @@ func (t *TUI) quickDraw() {
 }
 
 // renderModal displays a centered popup dialog. Optionally, if progress is greater than zero,
-// renders a progress bar at the bottom.
-func (t *TUI) renderModal(title string, msg string, progress float64) {
+// renders a progress bar at the bottom, labeled with the provided details.
+func (t *TUI) renderModal(title string, msg string, progress float64, details string) {
 	// Returns a new primitive which puts the provided primitive in the center and
 	// sets its size to the given width and height.
 	modal := func(p tview.Primitive, width, height int) tview.Primitive {
@@ -215,6 +215,7 @@ func (t *TUI) renderModal(title string, msg string, progress float64) {
 		progressBar := NewProgressBar()
 		progressBar.SetMax(100)
 		progressBar.SetProgress(int64(progress * 100))
+		progressBar.SetLabel(details)
 		grid.SetRows(modalHeight-6, 1).AddItem(progressBar, 1, 0, 1, 1, 0, 0, false)
 	}
 
@@ -254,6 +255,13 @@ func (t *TUI) redrawScreen() {
 			t.frame.AddText(line, false, tview.AlignLeft, tcell.ColorWhite)
 		}
 
+		history := t.getRecentHistory(3)
+		if len(history) > 0 {
+			for _, line := range wrapFooterText("Recent history", strings.Join(history, ", "), consoleWidth) {
+				t.frame.AddText(line, false, tview.AlignLeft, tcell.ColorWhite)
+			}
+		}
+
 		if !t.state.System.Encryption.State.RecoveryKeysRetrieved {
 			t.frame.AddText("WARNING: Encryption recovery key has not been retrieved yet!", false, tview.AlignLeft, tcell.ColorRed)
 		}
@@ -267,6 +275,37 @@ func (t *TUI) redrawScreen() {
 	t.app.Draw()
 }
 
+// Return a short summary of the latest history entries, newest first.
+func (t *TUI) getRecentHistory(count int) []string {
+	entries, err := t.state.GetHistory()
+	if err != nil {
+		return []string{}
+	}
+
+	ret := []string{}
+
+	for _, entry := range slices.Backward(entries) {
+		if len(ret) >= count {
+			break
+		}
+
+		summary := entry.Timestamp.UTC().Format("2006-01-02 15:04") + " " + string(entry.Type)
+		if entry.Component != "" {
+			summary += " " + entry.Component
+		}
+
+		if entry.ToVersion != "" {
+			summary += " " + entry.ToVersion
+		}
+
+		summary += " (" + string(entry.Outcome) + ")"
+
+		ret = append(ret, summary)
+	}
+
+	return ret
+}
+
 // Return a list of IP addresses for configured interfaces.
 func (t *TUI) getIPAddresses() []string {
 	if t.state.System.Network.Config == nil {
@@ -0,0 +1,42 @@
+#!/bin/bash
+
+set -e
+
+# This script builds an update bundle out of the files of a release, as published on GitHub. The full
+# install images and the flasher tool aren't needed to update a system and are left out.
+
+if [ "$#" -ne 2 ]; then
+    echo "Usage: $0 <release directory> <output bundle>"
+    exit 1
+fi
+
+SRC=$1
+DST=$(realpath "$2")
+
+if [ ! -e "$SRC/SHA256SUMS" ] || [ ! -e "$SRC/SHA256SUMS.sig" ]; then
+    echo "Missing the signed SHA256SUMS in $SRC"
+    exit 1
+fi
+
+cd "$SRC"
+
+# Only keep the files covered by the release manifest.
+FILES=()
+while read -r _ NAME; do
+    NAME="${NAME#\*}"
+
+    case "$NAME" in
+        *.img.gz|*.iso.gz|flasher-tool*)
+            continue
+            ;;
+    esac
+
+    if [ ! -e "$NAME" ]; then
+        echo "Missing $NAME"
+        exit 1
+    fi
+
+    FILES+=("$NAME")
+done < SHA256SUMS
+
+tar -czf "$DST" SHA256SUMS SHA256SUMS.sig "${FILES[@]}"